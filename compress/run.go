@@ -1,10 +1,28 @@
 package compress
 
 import (
-	"log"
+	"context"
+	"io"
+
+	"github.com/ZymoticB/goxz/xz"
 )
 
-func RunCompress(source, dest string) error {
-	log.Print("RunCompress")
-	return nil
+func RunCompress(in io.Reader, dest io.Writer, config xz.WriterConfig) error {
+	return Run(context.Background(), in, dest, config)
+}
+
+// Run compresses in to dest until ctx is done, which stops it with an
+// xz.CanceledError. The filters' buffers are given back however it ends.
+func Run(ctx context.Context, in io.Reader, dest io.Writer, config xz.WriterConfig) error {
+	config.Context = ctx
+	w, err := xz.NewWriter(dest, config)
+	if err != nil {
+		return err
+	}
+	defer w.Abort()
+	_, err = io.Copy(w, in)
+	if err != nil {
+		return err
+	}
+	return w.Close()
 }
@@ -0,0 +1,111 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+var errRead = errors.New("Read failed")
+
+// poolFilter is a filter whose writers take a buffer from free and give it
+// back when closed or released, like the LZMA2 window pool but without
+// sync.Pool dropping entries.
+type poolFilter struct {
+	free *[]*[]byte
+}
+
+func (f poolFilter) ID() xz.MultiByteInteger {
+	return 0x4000000000000001
+}
+
+func (f poolFilter) EncodeProperties() []byte {
+	return nil
+}
+
+func (f poolFilter) NewReader(r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+func (f poolFilter) NewWriter(w io.WriteCloser) (io.WriteCloser, error) {
+	p := &poolWriter{WriteCloser: w, free: f.free}
+	if n := len(*f.free); n > 0 {
+		p.buf, *f.free = (*f.free)[n-1], (*f.free)[:n-1]
+	} else {
+		p.buf = new([]byte)
+	}
+	return p, nil
+}
+
+type poolWriter struct {
+	io.WriteCloser
+	free *[]*[]byte
+	buf  *[]byte
+}
+
+func (p *poolWriter) Close() error {
+	p.Release()
+	return p.WriteCloser.Close()
+}
+
+func (p *poolWriter) Release() {
+	if p.buf != nil {
+		*p.free = append(*p.free, p.buf)
+		p.buf = nil
+	}
+}
+
+// cancelReader cancels its Context on the second read, once a Block is
+// started.
+type cancelReader struct {
+	io.Reader
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads == 2 {
+		r.cancel()
+	}
+	return r.Reader.Read(p)
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errRead
+}
+
+func TestRunReleasesFilters(t *testing.T) {
+	var free []*[]byte
+	config := xz.WriterConfig{Filters: xz.FilterChain{poolFilter{&free}}}
+	input := bytes.Repeat([]byte("goxz"), 256*1024)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := &cancelReader{Reader: bytes.NewReader(input), cancel: cancel}
+	err := Run(ctx, in, ioutil.Discard, config)
+	_, canceled := err.(*xz.CanceledError)
+	assert.True(t, canceled, "canceled mid-copy: %v", err)
+	if !assert.Equal(t, len(free), 1, "the canceled Block's buffer should be given back") {
+		return
+	}
+	released := free[0]
+
+	err = Run(context.Background(), errReader{}, ioutil.Discard, config)
+	assert.Equal(t, err, errRead)
+	assert.Equal(t, len(free), 1, "the buffer should be given back after a read error")
+	assert.True(t, free[0] == released, "the buffer should be reused")
+
+	err = Run(context.Background(), bytes.NewReader(input), ioutil.Discard, config)
+	assert.Nil(t, err)
+	assert.Equal(t, len(free), 1, "the buffer should be given back once")
+	assert.True(t, free[0] == released, "the buffer should be reused")
+}
@@ -1,10 +1,26 @@
 package decompress
 
 import (
-	"github.com/ZymoticB/goxz/output"
+	"context"
+	"io"
+
+	"github.com/ZymoticB/goxz/xz"
+	// register the filters defined by the xz format
+	_ "github.com/ZymoticB/goxz/xz/filters"
 )
 
-func RunDecompress(source, dest string, out output.Output) error {
-	out.Print("RunDecompress")
-	return nil
+func RunDecompress(in io.Reader, dest io.Writer, config xz.ReaderConfig) error {
+	return Run(context.Background(), in, dest, config)
+}
+
+// Run decompresses in to dest until ctx is done, which stops it with an
+// xz.CanceledError.
+func Run(ctx context.Context, in io.Reader, dest io.Writer, config xz.ReaderConfig) error {
+	config.Context = ctx
+	r, err := xz.NewReaderConfig(in, config)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dest, r)
+	return err
 }
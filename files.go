@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errIsDirectory = errors.New("Is a directory, skipping")
+var errUnknownSuffix = errors.New("Filename has an unknown suffix, skipping")
+var errHasSuffix = errors.New("Filename already has an xz suffix, skipping")
+var errOutputWithManyInputs = errors.New("--output can only be used with a single input")
+var errOutputExists = errors.New("Output file exists, use --force to overwrite it")
+var errOutputIsInput = errors.New("Output file is the same as the input file")
+
+// xzSuffixes maps the suffixes of xz files to the suffix of the file they
+// decompress to.
+var xzSuffixes = []struct {
+	compressed, uncompressed string
+}{
+	{".xz", ""},
+	{".txz", ".tar"},
+}
+
+// inputPath is an input to process, or with err set a path that could not be
+// searched for inputs.
+type inputPath struct {
+	path string
+	err  error
+}
+
+// collectInputs returns the input files in the order given, standard input if
+// there are none. With recursive set directories are replaced by the files in
+// them, paths that can not be searched are returned with their error so the
+// other inputs are still processed.
+func collectInputs(opts Options) []inputPath {
+	var paths []string
+	if opts.FOpts.Input != "" {
+		paths = append(paths, opts.FOpts.Input)
+	}
+	paths = append(paths, opts.Args.Files...)
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	var inputs []inputPath
+	for _, path := range paths {
+		if !opts.FOpts.Recursive || isStdio(path) {
+			inputs = append(inputs, inputPath{path: path})
+			continue
+		}
+		filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				inputs = append(inputs, inputPath{path, err})
+				return nil
+			}
+			if info.Mode().IsRegular() {
+				inputs = append(inputs, inputPath{path: path})
+			}
+			return nil
+		})
+	}
+	return inputs
+}
+
+// outputName is the name xz would give the output of method run on path.
+func outputName(path, method string) (string, error) {
+	name := filepath.Base(path)
+	for _, suffix := range xzSuffixes {
+		if !strings.HasSuffix(name, suffix.compressed) || name == suffix.compressed {
+			continue
+		}
+		if method == "compress" {
+			return "", errHasSuffix
+		}
+		return strings.TrimSuffix(path, suffix.compressed) + suffix.uncompressed, nil
+	}
+
+	if method == "compress" {
+		return path + ".xz", nil
+	}
+	return "", errUnknownSuffix
+}
+
+// countingReader and countingWriter count the bytes for the summary.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// summary totals the results of all the files processed.
+type summary struct {
+	files, failed, skipped int
+	in, out                int64
+}
+
+func (s *summary) add(in, out int64, err error) {
+	s.files++
+	if isWarning(err) {
+		s.skipped++
+		return
+	}
+	if err != nil {
+		s.failed++
+		return
+	}
+	s.in += in
+	s.out += out
+}
+
+func (s summary) String() string {
+	ratio := 0.0
+	if s.in > 0 {
+		ratio = float64(s.out) / float64(s.in)
+	}
+	return fmt.Sprintf("%d files, %d failed, %d skipped: %d bytes in, %d bytes out, ratio %.3f\n",
+		s.files, s.failed, s.skipped, s.in, s.out, ratio)
+}
+
+// err is the fileErrors for the summary, nil if every file succeeded.
+func (s summary) err() error {
+	if s.failed == 0 && s.skipped == 0 {
+		return nil
+	}
+	return fileErrors{failed: s.failed, skipped: s.skipped}
+}
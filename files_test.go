@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputName(t *testing.T) {
+	tests := []struct {
+		path     string
+		method   string
+		expected string
+		err      error
+	}{
+		{"foo", "compress", "foo.xz", nil},
+		{"dir/foo.tar", "compress", "dir/foo.tar.xz", nil},
+		{"foo.xz", "compress", "", errHasSuffix},
+		{"foo.xz", "decompress", "foo", nil},
+		{"dir.xz/foo.txz", "decompress", "dir.xz/foo.tar", nil},
+		{"foo", "decompress", "", errUnknownSuffix},
+		{"dir/.xz", "decompress", "", errUnknownSuffix},
+	}
+	for _, tt := range tests {
+		name, err := outputName(tt.path, tt.method)
+		assert.Equal(t, err, tt.err, "%s %s", tt.method, tt.path)
+		assert.Equal(t, name, tt.expected, "%s %s", tt.method, tt.path)
+	}
+}
+
+func TestCollectInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goxz")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a", "sub/b", "sub/c"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+	}
+
+	var opts Options
+	inputs := collectInputs(opts)
+	assert.Equal(t, inputs, []inputPath{{path: "-"}}, "standard input should be read without files")
+
+	opts.FOpts.Input = "x"
+	opts.Args.Files = []string{dir, "y"}
+	inputs = collectInputs(opts)
+	assert.Equal(t, inputs, []inputPath{{path: "x"}, {path: dir}, {path: "y"}}, "directories should only be expanded with -r")
+
+	// a path that can not be searched does not stop the others
+	missing := filepath.Join(dir, "missing")
+	opts = Options{}
+	opts.FOpts.Recursive = true
+	opts.Args.Files = []string{missing, dir, "-"}
+	inputs = collectInputs(opts)
+	assert.Equal(t, len(inputs), 5)
+	assert.Equal(t, inputs[0].path, missing)
+	assert.True(t, os.IsNotExist(inputs[0].err), "the missing path should have its error")
+	assert.Equal(t, inputs[1:], []inputPath{
+		{path: filepath.Join(dir, "a")}, {path: filepath.Join(dir, "sub/b")}, {path: filepath.Join(dir, "sub/c")}, {path: "-"},
+	})
+}
+
+func TestCreateOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goxz")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("existing"), 0644))
+
+	_, err = createOutput(path, false)
+	assert.Equal(t, err, errOutputExists, "existing files need --force")
+
+	// nothing is replaced until the output is committed
+	f, err := createOutput(path, true)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Dir(f.Name()), dir, "temporary file directory")
+	_, err = f.WriteString("partial")
+	assert.Nil(t, err)
+	f.Abort()
+	buf, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, string(buf), "existing", "an aborted output should not replace the file")
+
+	f, err = createOutput(path, true)
+	assert.Nil(t, err)
+	_, err = f.WriteString("complete")
+	assert.Nil(t, err)
+	assert.Nil(t, f.Commit())
+	buf, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, string(buf), "complete", "a committed output should replace the file")
+
+	names, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, len(names), 1, "temporary files should be removed")
+	assert.Equal(t, len(tempFiles.paths), 0, "temporary files should no longer be tracked")
+}
+
+func TestCopyMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goxz")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "in")
+	assert.Nil(t, ioutil.WriteFile(input, nil, 0640))
+	assert.Nil(t, os.Chmod(input, 0640))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Nil(t, os.Chtimes(input, mtime, mtime))
+	info, err := os.Stat(input)
+	assert.Nil(t, err)
+
+	f, err := os.Create(filepath.Join(dir, "out"))
+	assert.Nil(t, err)
+	assert.Nil(t, copyMetadata(info, f))
+	assert.Nil(t, f.Close())
+
+	out, err := os.Stat(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, out.Mode().Perm(), os.FileMode(0640), "permissions")
+	assert.True(t, out.ModTime().Equal(mtime), "modification time")
+}
@@ -0,0 +1,293 @@
+package inspect
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ZymoticB/goxz/list"
+	"github.com/ZymoticB/goxz/xz"
+	"github.com/ZymoticB/goxz/xz/filters"
+)
+
+const (
+	// bytesPerLine is how many raw bytes are shown on each line, longer
+	// fields continue on the following lines.
+	bytesPerLine = 16
+	// shortDataLines is how much of the Compressed Data is shown unless all
+	// of it is asked for.
+	shortDataLines = 2
+	nameWidth      = 28
+	// unparsedBytes is how much is shown of a structure that failed to
+	// parse.
+	unparsedBytes = 2 * bytesPerLine
+)
+
+// Report is the JSON output of an Inspector. Its fields and their names are
+// stable, new fields may be added.
+type Report struct {
+	Files []FileReport `json:"files"`
+}
+
+// FileReport holds the top level Structures of a file, which are Streams,
+// Stream Padding and the start of anything that failed to parse. Error is
+// why it failed.
+type FileReport struct {
+	Name       string       `json:"name"`
+	Error      string       `json:"error,omitempty"`
+	Structures []*Structure `json:"structures"`
+}
+
+// Structure is a section such as a Block Header, which has Children, or a
+// field of one. Raw is the bytes of a field in hex, only the start of the
+// Compressed Data unless all of it is asked for.
+type Structure struct {
+	Name     string       `json:"name"`
+	Offset   int64        `json:"offset"`
+	Size     int64        `json:"size"`
+	Raw      string       `json:"raw,omitempty"`
+	Note     string       `json:"note,omitempty"`
+	Children []*Structure `json:"children,omitempty"`
+}
+
+// Inspector prints the structures of xz files in a list.Format. The text and
+// robot forms are printed as each file is inspected, the JSON form on Close.
+type Inspector struct {
+	w      io.Writer
+	full   bool
+	format list.Format
+	report Report
+}
+
+// NewInspector creates an Inspector that writes to w. With full set the
+// Compressed Data of each Block is shown in full instead of only its start.
+func NewInspector(w io.Writer, full bool, format list.Format) *Inspector {
+	return &Inspector{w: w, full: full, format: format, report: Report{Files: []FileReport{}}}
+}
+
+// Inspect prints the structures of the xz file r of the given size, named name
+// in the robot and JSON forms.
+func (in *Inspector) Inspect(r io.ReaderAt, size int64, name string) error {
+	switch in.format {
+	case list.JSON:
+		p := &treePrinter{root: []*Structure{}}
+		err := run(r, size, p, in.full)
+		file := FileReport{Name: name, Structures: p.root}
+		if err != nil {
+			file.Error = err.Error()
+		}
+		in.report.Files = append(in.report.Files, file)
+		return err
+	case list.Robot:
+		fmt.Fprintf(in.w, "name\t%s\n", name)
+		return run(r, size, &robotPrinter{in.w}, in.full)
+	}
+	return run(r, size, &textPrinter{in.w}, in.full)
+}
+
+// Close writes the JSON output.
+func (in *Inspector) Close() error {
+	if in.format != list.JSON {
+		return nil
+	}
+	enc := json.NewEncoder(in.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(in.report)
+}
+
+// dumper finds the structures of an xz file in order, reading their raw bytes
+// back from the file.
+type dumper struct {
+	p    printer
+	r    io.ReaderAt
+	off  int64
+	full bool
+	// end is how far Stream.ReadStream got, nothing past it is printed
+	end int64
+}
+
+// RunInspect prints every structure in the xz file r of the given size with
+// its offset and raw bytes. With full set the Compressed Data of each Block is
+// dumped too instead of only its start.
+func RunInspect(r io.ReaderAt, size int64, dest io.Writer, full bool) error {
+	return run(r, size, &textPrinter{dest}, full)
+}
+
+func run(r io.ReaderAt, size int64, p printer, full bool) error {
+	section := io.NewSectionReader(r, 0, size)
+	br := bufio.NewReader(section)
+	d := &dumper{p: p, r: r, full: full}
+	for n := 1; ; n++ {
+		if _, err := br.Peek(1); err == io.EOF {
+			return nil
+		}
+
+		var stream xz.Stream
+		err := stream.ReadStream(br)
+		pos, _ := section.Seek(0, io.SeekCurrent)
+		d.end = pos - int64(br.Buffered())
+		d.stream(n, &stream)
+		if err != nil {
+			// show the start of the structure that could not be read
+			unparsed := size - d.off
+			if unparsed > unparsedBytes {
+				unparsed = unparsedBytes
+			}
+			d.field(0, "Unparsed", unparsed, "")
+			return fmt.Errorf("%v, at offset %d (0x%x)", err, d.end, d.end)
+		}
+	}
+}
+
+// fits tells whether n more bytes were read by Stream.ReadStream.
+func (d *dumper) fits(n int64) bool {
+	return d.off+n <= d.end
+}
+
+func (d *dumper) section(depth int, format string, args ...interface{}) {
+	d.p.section(d.off, depth, fmt.Sprintf(format, args...))
+}
+
+// field prints the next n bytes as the named field and moves past them.
+func (d *dumper) field(depth int, name string, n int64, note string) {
+	raw := make([]byte, n)
+	_, err := d.r.ReadAt(raw, d.off)
+	if err != nil && err != io.EOF {
+		note = err.Error()
+	}
+	d.p.field(d.off, depth, name, raw, n, note)
+	d.off += n
+}
+
+func (d *dumper) multiByte(depth int, name string, n xz.MultiByteInteger, note string) {
+	if note == "" {
+		note = fmt.Sprintf("%d", uint64(n))
+	}
+	d.field(depth, name, multiByteSize(n), note)
+}
+
+// stream prints the parts of the Stream that Stream.ReadStream got through.
+func (d *dumper) stream(n int, s *xz.Stream) {
+	if !d.fits(12) {
+		return
+	}
+	d.section(0, "Stream %d", n)
+	d.section(1, "Stream Header")
+	d.field(2, "Magic", 6, "")
+	d.field(2, "Stream Flags", 2, "check "+s.Header.Flags.CheckName())
+	d.field(2, "CRC32", 4, "")
+
+	for i, b := range s.Blocks {
+		d.block(i+1, b, s.Header.Flags)
+	}
+	if !d.index(&s.Index) || !d.fits(12) {
+		return
+	}
+
+	d.section(1, "Stream Footer")
+	d.field(2, "CRC32", 4, "")
+	d.field(2, "Backward Size", 4, fmt.Sprintf("Index is %d bytes", 4*(uint64(s.Footer.BackwardSize)+1)))
+	d.field(2, "Stream Flags", 2, "check "+s.Footer.Flags.CheckName())
+	d.field(2, "Magic", 2, "")
+
+	if len(s.Padding) > 0 {
+		d.field(0, "Stream Padding", int64(4*len(s.Padding)), fmt.Sprintf("%d bytes", 4*len(s.Padding)))
+	}
+}
+
+func (d *dumper) block(n int, b *xz.Block, flags xz.StreamFlags) {
+	h := &b.Header
+	d.section(1, "Block %d", n)
+	d.section(2, "Block Header")
+	d.field(3, "Header Size", 1, fmt.Sprintf("%d bytes", h.Size()))
+
+	compressed, uncompressed := h.HasSizes()
+	notes := []string{"1 filter"}
+	if n := len(h.Filters()); n > 1 {
+		notes[0] = fmt.Sprintf("%d filters", n)
+	}
+	if compressed {
+		notes = append(notes, "compressed size")
+	}
+	if uncompressed {
+		notes = append(notes, "uncompressed size")
+	}
+	d.field(3, "Block Flags", 1, strings.Join(notes, ", "))
+	if compressed {
+		d.multiByte(3, "Compressed Size", h.CompressedSize, "")
+	}
+	if uncompressed {
+		d.multiByte(3, "Uncompressed Size", h.UncompressedSize, "")
+	}
+
+	for i, f := range h.Filters() {
+		filter, err := xz.NewFilter(f)
+		describe := ""
+		if err != nil {
+			describe = err.Error()
+		} else {
+			describe = filters.Describe(filter)
+		}
+		d.multiByte(3, fmt.Sprintf("Filter %d ID", i+1), f.ID, fmt.Sprintf("0x%02x", uint64(f.ID)))
+		d.multiByte(3, "Properties Size", f.Size, "")
+		d.field(3, "Properties", int64(len(f.Properties)), describe)
+	}
+	if len(h.Padding) > 0 {
+		d.field(3, "Header Padding", int64(len(h.Padding)), "")
+	}
+	d.field(3, "CRC32", 4, "")
+
+	d.data(b.CompressedData)
+	if len(b.Padding) > 0 {
+		d.field(2, "Block Padding", int64(len(b.Padding)), "")
+	}
+	if len(b.Check) > 0 {
+		d.field(2, "Check", int64(len(b.Check)), flags.CheckName())
+	}
+}
+
+func (d *dumper) data(data []byte) {
+	shown := data
+	if !d.full && len(shown) > shortDataLines*bytesPerLine {
+		shown = shown[:shortDataLines*bytesPerLine]
+	}
+	d.p.field(d.off, 2, "Compressed Data", shown, int64(len(data)), fmt.Sprintf("%d bytes", len(data)))
+	d.off += int64(len(data))
+}
+
+// index prints the Index if it was read.
+func (d *dumper) index(index *xz.Index) bool {
+	var indicator [1]byte
+	_, err := d.r.ReadAt(indicator[:], d.off)
+	if err != nil || indicator[0] != 0x00 || !d.fits(indexSize(index)) {
+		return false
+	}
+
+	d.section(1, "Index")
+	d.field(2, "Index Indicator", 1, "")
+	d.multiByte(2, "Number of Records", index.NumberOfRecords, "")
+	for i, record := range index.Records {
+		d.multiByte(2, fmt.Sprintf("Record %d Unpadded Size", i+1), record.UnpaddedSize, "")
+		d.multiByte(2, "  Uncompressed Size", record.UncompressedSize, "")
+	}
+	if len(index.Padding) > 0 {
+		d.field(2, "Index Padding", int64(len(index.Padding)), "")
+	}
+	d.field(2, "CRC32", 4, "")
+	return true
+}
+
+func indexSize(index *xz.Index) int64 {
+	size := 1 + multiByteSize(index.NumberOfRecords)
+	for _, record := range index.Records {
+		size += multiByteSize(record.UnpaddedSize) + multiByteSize(record.UncompressedSize)
+	}
+	return size + int64(len(index.Padding)) + 4
+}
+
+func multiByteSize(n xz.MultiByteInteger) int64 {
+	enc, _ := n.Encode()
+	return int64(len(enc))
+}
@@ -0,0 +1,73 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/list"
+)
+
+func TestRunInspect(t *testing.T) {
+	buf, err := ioutil.ReadFile("../test/test1.txt.xz")
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	err = RunInspect(bytes.NewReader(buf), int64(len(buf)), &out, false)
+	assert.Nil(t, err)
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, len(lines), 30, "number of lines")
+	assert.Equal(t, lines[11], "00000010        Properties             16                                               --lzma2=dict=8MiB", "LZMA2 properties")
+	assert.Equal(t, lines[15], "00000028                               74 0a 00", "second line of the Compressed Data")
+	assert.Equal(t, lines[28], "00000046      Magic                    59 5a", "Stream Footer magic")
+}
+
+func TestRunInspectError(t *testing.T) {
+	buf, err := ioutil.ReadFile("../test/test1.txt.xz")
+	assert.Nil(t, err)
+	// break the Block Header CRC32
+	buf[0x14] ^= 0x01
+
+	var out bytes.Buffer
+	err = RunInspect(bytes.NewReader(buf), int64(len(buf)), &out, false)
+	assert.Equal(t, err.Error(), "Block header CRC32 does not match, at offset 24 (0x18)", "error")
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, lines[5], "0000000c  Unparsed                     02 00 21 01 16 00 00 00 75 2f e5 a3 01 00 0e 74", "bytes that failed to parse")
+}
+
+func TestInspectorFormats(t *testing.T) {
+	buf, err := ioutil.ReadFile("../test/test1.txt.xz")
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	inspector := NewInspector(&out, false, list.Robot)
+	assert.Nil(t, inspector.Inspect(bytes.NewReader(buf), int64(len(buf)), "test1.txt.xz"))
+	assert.Nil(t, inspector.Close())
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, lines[0], "name\ttest1.txt.xz")
+	assert.Equal(t, lines[12], "field\t3\t16\t1\tProperties\t16\t--lzma2=dict=8MiB", "LZMA2 properties")
+
+	out.Reset()
+	inspector = NewInspector(&out, false, list.JSON)
+	assert.Nil(t, inspector.Inspect(bytes.NewReader(buf), int64(len(buf)), "test1.txt.xz"))
+	assert.Nil(t, inspector.Close())
+	var report Report
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, len(report.Files), 1)
+	stream := report.Files[0].Structures[0]
+	assert.Equal(t, stream.Name, "Stream 1")
+	assert.Equal(t, stream.Size, int64(len(buf)), "the Stream is the whole file")
+	names := []string{}
+	for _, s := range stream.Children {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, names, []string{"Stream Header", "Block 1", "Index", "Stream Footer"})
+	data := stream.Children[1].Children[1]
+	assert.Equal(t, data.Name, "Compressed Data")
+	assert.Equal(t, data.Size, int64(19))
+	assert.Equal(t, data.Raw, "01000e74686973206973206120746573740a00")
+}
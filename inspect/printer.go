@@ -0,0 +1,110 @@
+package inspect
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// printer is where a dumper sends the structures it finds. Sections group the
+// fields that follow them at a greater depth. raw is the part of a field's
+// size bytes that is shown.
+type printer interface {
+	section(off int64, depth int, title string)
+	field(off int64, depth int, name string, raw []byte, size int64, note string)
+}
+
+// textPrinter prints a line per section and per bytesPerLine of each field.
+type textPrinter struct {
+	w io.Writer
+}
+
+func (p *textPrinter) section(off int64, depth int, title string) {
+	fmt.Fprintf(p.w, "%08x  %s%s\n", off, strings.Repeat("  ", depth), title)
+}
+
+func (p *textPrinter) field(off int64, depth int, name string, raw []byte, size int64, note string) {
+	label := fmt.Sprintf("%-*s", nameWidth, strings.Repeat("  ", depth)+name)
+	for {
+		chunk := raw
+		if len(chunk) > bytesPerLine {
+			chunk = chunk[:bytesPerLine]
+		}
+		line := fmt.Sprintf("%08x  %s %-*s  %s", off, label, 3*bytesPerLine-1, hexBytes(chunk), note)
+		fmt.Fprintln(p.w, strings.TrimRight(line, " "))
+		raw = raw[len(chunk):]
+		off += int64(len(chunk))
+		size -= int64(len(chunk))
+		if len(raw) == 0 {
+			break
+		}
+		label, note = strings.Repeat(" ", nameWidth), ""
+	}
+	if size > 0 {
+		fmt.Fprintf(p.w, "%08x  %s ... %d more bytes\n", off, strings.Repeat(" ", nameWidth), size)
+	}
+}
+
+func hexBytes(b []byte) string {
+	s := hex.EncodeToString(b)
+	var spaced []string
+	for i := 0; i < len(s); i += 2 {
+		spaced = append(spaced, s[i:i+2])
+	}
+	return strings.Join(spaced, " ")
+}
+
+// robotPrinter prints a tab separated line per section and field:
+//
+//	section	<depth>	<offset>	<title>
+//	field	<depth>	<offset>	<size>	<name>	<hex>	<note>
+type robotPrinter struct {
+	w io.Writer
+}
+
+func (p *robotPrinter) section(off int64, depth int, title string) {
+	fmt.Fprintf(p.w, "section\t%d\t%d\t%s\n", depth, off, title)
+}
+
+func (p *robotPrinter) field(off int64, depth int, name string, raw []byte, size int64, note string) {
+	fmt.Fprintf(p.w, "field\t%d\t%d\t%d\t%s\t%s\t%s\n", depth, off, size, strings.TrimSpace(name), hex.EncodeToString(raw), note)
+}
+
+// treePrinter builds the Structures of the JSON output.
+type treePrinter struct {
+	root []*Structure
+	// open are the sections the next structure may be in, by depth
+	open []*Structure
+}
+
+func (p *treePrinter) section(off int64, depth int, title string) {
+	p.add(depth, &Structure{Name: title, Offset: off, Children: []*Structure{}})
+}
+
+func (p *treePrinter) field(off int64, depth int, name string, raw []byte, size int64, note string) {
+	p.add(depth, &Structure{
+		Name:   strings.TrimSpace(name),
+		Offset: off,
+		Size:   size,
+		Raw:    hex.EncodeToString(raw),
+		Note:   note,
+	})
+	// the sections it is in grow to its end
+	for _, s := range p.open[:len(p.open)-1] {
+		s.Size = off + size - s.Offset
+	}
+}
+
+func (p *treePrinter) add(depth int, s *Structure) {
+	if depth > len(p.open) {
+		depth = len(p.open)
+	}
+	if depth == 0 {
+		p.root = append(p.root, s)
+	} else {
+		parent := p.open[depth-1]
+		parent.Children = append(parent.Children, s)
+	}
+	p.open = append(p.open[:depth], s)
+}
@@ -0,0 +1,160 @@
+package list
+
+import (
+	"io"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+// Report is the JSON output of a Lister. Its fields and their names are
+// stable, new fields may be added. Sizes and offsets are in bytes and a Ratio
+// is the compressed size divided by the uncompressed size, 0 if nothing was
+// compressed.
+type Report struct {
+	Files  []FileReport `json:"files"`
+	Totals Totals       `json:"totals"`
+}
+
+// Summary totals the Streams of one or more files.
+type Summary struct {
+	StreamCount      int      `json:"stream_count"`
+	BlockCount       int      `json:"block_count"`
+	CompressedSize   int64    `json:"compressed_size"`
+	UncompressedSize int64    `json:"uncompressed_size"`
+	Ratio            float64  `json:"ratio"`
+	Checks           []string `json:"checks"`
+	StreamPadding    int64    `json:"stream_padding"`
+	// MemoryNeeded is an estimate of the memory needed to decompress
+	MemoryNeeded   uint64 `json:"memory_needed"`
+	SizesInHeaders bool   `json:"sizes_in_headers"`
+	MinXZVersion   string `json:"min_xz_version"`
+}
+
+type Totals struct {
+	Files int `json:"files"`
+	Summary
+}
+
+type FileReport struct {
+	Name string `json:"name"`
+	Summary
+	Streams []StreamReport `json:"streams"`
+}
+
+type StreamReport struct {
+	Number             int           `json:"number"`
+	CompressedOffset   int64         `json:"compressed_offset"`
+	UncompressedOffset int64         `json:"uncompressed_offset"`
+	CompressedSize     int64         `json:"compressed_size"`
+	UncompressedSize   int64         `json:"uncompressed_size"`
+	Ratio              float64       `json:"ratio"`
+	Check              string        `json:"check"`
+	Padding            int64         `json:"padding"`
+	Index              IndexReport   `json:"index"`
+	Blocks             []BlockReport `json:"blocks"`
+}
+
+type IndexReport struct {
+	Records int   `json:"records"`
+	Size    int64 `json:"size"`
+}
+
+type BlockReport struct {
+	// Number counts the Blocks of the file, NumberInStream those of the
+	// Stream.
+	Number             int     `json:"number"`
+	NumberInStream     int     `json:"number_in_stream"`
+	CompressedOffset   int64   `json:"compressed_offset"`
+	UncompressedOffset int64   `json:"uncompressed_offset"`
+	TotalSize          int64   `json:"total_size"`
+	UnpaddedSize       int64   `json:"unpadded_size"`
+	UncompressedSize   int64   `json:"uncompressed_size"`
+	Ratio              float64 `json:"ratio"`
+	// CheckValue is in hex as xz shows it, empty for the None check
+	CheckValue string `json:"check_value"`
+	HeaderSize int    `json:"header_size"`
+	// CompressedDataSize is the size of the data the filters decode
+	CompressedDataSize       int64    `json:"compressed_data_size"`
+	CompressedSizeInHeader   bool     `json:"compressed_size_in_header"`
+	UncompressedSizeInHeader bool     `json:"uncompressed_size_in_header"`
+	MemoryNeeded             uint64   `json:"memory_needed"`
+	Filters                  []string `json:"filters"`
+}
+
+func newSummary(t totals) Summary {
+	s := Summary{
+		StreamCount:      t.streams,
+		BlockCount:       t.blocks,
+		CompressedSize:   t.compressed,
+		UncompressedSize: t.uncompressed,
+		Ratio:            ratioValue(t.compressed, t.uncompressed),
+		Checks:           []string{},
+		StreamPadding:    t.padding,
+		MemoryNeeded:     t.memory,
+		SizesInHeaders:   t.sizesInHeaders,
+		MinXZVersion:     t.minVersion,
+	}
+	for id, used := range t.checks {
+		if used {
+			flags := xz.StreamFlags{0, byte(id)}
+			s.Checks = append(s.Checks, flags.CheckName())
+		}
+	}
+	return s
+}
+
+func newFileReport(r io.ReaderAt, name string, t totals, streams []xz.StreamInfo) FileReport {
+	f := FileReport{Name: name, Summary: newSummary(t), Streams: []StreamReport{}}
+	number := 0
+	for i := range streams {
+		s := &streams[i]
+		stream := StreamReport{
+			Number:             i + 1,
+			CompressedOffset:   s.Offset,
+			UncompressedOffset: s.UncompressedOffset,
+			CompressedSize:     s.CompressedSize(),
+			UncompressedSize:   s.UncompressedSize(),
+			Ratio:              ratioValue(s.CompressedSize(), s.UncompressedSize()),
+			Check:              s.Header.Flags.CheckName(),
+			Padding:            s.Padding,
+			Index:              IndexReport{Records: len(s.Index.Records), Size: s.IndexSize()},
+			Blocks:             []BlockReport{},
+		}
+		for j := range s.Blocks {
+			b := &s.Blocks[j]
+			number++
+			d := readBlockDetails(r, s, b)
+			checkValue := d.checkVal
+			if checkValue == "---" {
+				checkValue = ""
+			}
+			compressed, uncompressed := b.SizesInHeader()
+			stream.Blocks = append(stream.Blocks, BlockReport{
+				Number:                   number,
+				NumberInStream:           j + 1,
+				CompressedOffset:         b.Offset,
+				UncompressedOffset:       b.UncompressedOffset,
+				TotalSize:                b.TotalSize(),
+				UnpaddedSize:             b.UnpaddedSize,
+				UncompressedSize:         b.UncompressedSize,
+				Ratio:                    ratioValue(b.TotalSize(), b.UncompressedSize),
+				CheckValue:               checkValue,
+				HeaderSize:               d.headerSize,
+				CompressedDataSize:       d.compressed,
+				CompressedSizeInHeader:   compressed,
+				UncompressedSizeInHeader: uncompressed,
+				MemoryNeeded:             d.memory,
+				Filters:                  d.filters,
+			})
+		}
+		f.Streams = append(f.Streams, stream)
+	}
+	return f
+}
+
+func ratioValue(compressed, uncompressed int64) float64 {
+	if uncompressed == 0 {
+		return 0
+	}
+	return float64(compressed) / float64(uncompressed)
+}
@@ -0,0 +1,372 @@
+package list
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ZymoticB/goxz/xz"
+	"github.com/ZymoticB/goxz/xz/filters"
+)
+
+// totals add up everything listed about one or more files.
+type totals struct {
+	files, streams, blocks   int
+	compressed, uncompressed int64
+	padding                  int64
+	// checks is indexed by check ID
+	checks         [16]bool
+	memory         uint64
+	sizesInHeaders bool
+	minVersion     string
+}
+
+func newTotals() totals {
+	return totals{sizesInHeaders: true, minVersion: "5.0.0"}
+}
+
+func (t *totals) add(other totals) {
+	t.files += other.files
+	t.streams += other.streams
+	t.blocks += other.blocks
+	t.compressed += other.compressed
+	t.uncompressed += other.uncompressed
+	t.padding += other.padding
+	for i, used := range other.checks {
+		t.checks[i] = t.checks[i] || used
+	}
+	if other.memory > t.memory {
+		t.memory = other.memory
+	}
+	t.sizesInHeaders = t.sizesInHeaders && other.sizesInHeaders
+	if other.minVersion > t.minVersion {
+		t.minVersion = other.minVersion
+	}
+}
+
+// filterVersions are the xz releases that added filters, older releases can
+// decode anything else.
+var filterVersions = map[xz.MultiByteInteger]string{
+	xz.FilterARM64: "5.4.0",
+	xz.FilterRISCV: "5.6.0",
+}
+
+// Format is how a Lister prints.
+type Format int
+
+const (
+	// Text is the human readable output of xz --list.
+	Text Format = iota
+	// JSON is a Report, written by Close.
+	JSON
+	// Robot is the tab separated output of xz --robot --list.
+	Robot
+)
+
+// Lister prints the structure of xz files like xz --list. At verbosity 0 each
+// file gets a line, 1 adds its Streams and Blocks and 2 reads the Block
+// Headers for their filters and memory usage. JSON always has everything.
+type Lister struct {
+	w         io.Writer
+	verbosity int
+	format    Format
+	total     totals
+	printed   int
+	report    Report
+}
+
+func NewLister(w io.Writer, verbosity int, format Format) *Lister {
+	return &Lister{w: w, verbosity: verbosity, format: format, total: newTotals()}
+}
+
+func (l *Lister) headers() bool {
+	return l.verbosity >= 2 || l.format == JSON
+}
+
+// List prints the file in r, which is size bytes long. It is one of count
+// files being listed, which xz numbers in verbose mode.
+func (l *Lister) List(r io.ReaderAt, size int64, name string, count int) error {
+	streams, err := xz.ReadInfo(r, size, l.headers())
+	if err != nil {
+		return err
+	}
+
+	t := newTotals()
+	t.files = 1
+	for i := range streams {
+		s := &streams[i]
+		t.streams++
+		t.blocks += len(s.Blocks)
+		t.compressed += s.CompressedSize() + s.Padding
+		t.uncompressed += s.UncompressedSize()
+		t.padding += s.Padding
+		t.checks[s.Header.Flags[1]&0xF] = true
+		if !l.headers() {
+			continue
+		}
+		for j := range s.Blocks {
+			b := &s.Blocks[j]
+			compressed, uncompressed := b.SizesInHeader()
+			t.sizesInHeaders = t.sizesInHeaders && compressed && uncompressed
+			if mem := blockMemory(&b.Header); mem > t.memory {
+				t.memory = mem
+			}
+			for _, f := range b.Header.Filters() {
+				if v := filterVersions[f.ID]; v > t.minVersion {
+					t.minVersion = v
+				}
+			}
+		}
+	}
+
+	l.printed++
+	l.total.add(t)
+	switch l.format {
+	case JSON:
+		l.report.Files = append(l.report.Files, newFileReport(r, name, t, streams))
+		return nil
+	case Robot:
+		l.printRobot(r, name, t, streams)
+		return nil
+	}
+
+	if l.verbosity == 0 {
+		if l.printed == 1 {
+			fmt.Fprintln(l.w, "Strms  Blocks   Compressed Uncompressed  Ratio  Check   Filename")
+		}
+		l.printLine(t, name)
+	} else {
+		if l.printed > 1 {
+			fmt.Fprintln(l.w)
+		}
+		fmt.Fprintf(l.w, "%s (%d/%d)\n", name, l.printed, count)
+		l.printSummary(t)
+		l.printStreams(streams, r)
+		l.printHeaderSummary(t)
+	}
+	return nil
+}
+
+// Close prints the totals if more than one file was listed, or for JSON and
+// Robot if any was.
+func (l *Lister) Close() error {
+	switch l.format {
+	case JSON:
+		l.report.Totals = Totals{Files: l.total.files, Summary: newSummary(l.total)}
+		if l.report.Files == nil {
+			l.report.Files = []FileReport{}
+		}
+		enc := json.NewEncoder(l.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(l.report)
+	case Robot:
+		if l.printed > 0 {
+			l.printRobotTotals()
+		}
+		return nil
+	}
+	if l.printed < 2 {
+		return nil
+	}
+	t := l.total
+	if l.verbosity == 0 {
+		fmt.Fprintln(l.w, strings.Repeat("-", 79))
+		l.printLine(t, fmt.Sprintf("%d files", t.files))
+		return nil
+	}
+	fmt.Fprintln(l.w)
+	fmt.Fprintln(l.w, "Totals:")
+	fmt.Fprintf(l.w, "  Number of files:   %d\n", t.files)
+	l.printSummary(t)
+	l.printHeaderSummary(t)
+	return nil
+}
+
+func (l *Lister) printLine(t totals, name string) {
+	fmt.Fprintf(l.w, "%5d %7d  %11s %12s  %5s  %-7s %s\n",
+		t.streams, t.blocks, niceSize(t.compressed), niceSize(t.uncompressed),
+		ratio(t.compressed, t.uncompressed), checkNames(t.checks, ","), name)
+}
+
+func (l *Lister) printSummary(t totals) {
+	fmt.Fprintf(l.w, "  Streams:           %d\n", t.streams)
+	fmt.Fprintf(l.w, "  Blocks:            %d\n", t.blocks)
+	fmt.Fprintf(l.w, "  Compressed size:   %s\n", exactSize(t.compressed))
+	fmt.Fprintf(l.w, "  Uncompressed size: %s\n", exactSize(t.uncompressed))
+	fmt.Fprintf(l.w, "  Ratio:             %s\n", ratio(t.compressed, t.uncompressed))
+	fmt.Fprintf(l.w, "  Check:             %s\n", checkNames(t.checks, ", "))
+	fmt.Fprintf(l.w, "  Stream Padding:    %s\n", exactSize(t.padding))
+}
+
+// printHeaderSummary prints what was learnt from the Block Headers.
+func (l *Lister) printHeaderSummary(t totals) {
+	if l.verbosity < 2 {
+		return
+	}
+	fmt.Fprintf(l.w, "  Memory needed:     %s\n", memory(t.memory))
+	fmt.Fprintf(l.w, "  Sizes in headers:  %s\n", yesNo(t.sizesInHeaders))
+	fmt.Fprintf(l.w, "  Minimum XZ Utils version: %s\n", t.minVersion)
+}
+
+func (l *Lister) printStreams(streams []xz.StreamInfo, r io.ReaderAt) {
+	fmt.Fprintln(l.w, "  Streams:")
+	fmt.Fprintln(l.w, "    Stream    Blocks      CompOffset    UncompOffset        CompSize      UncompSize  Ratio  Check      Padding")
+	for i := range streams {
+		s := &streams[i]
+		fmt.Fprintf(l.w, "    %6d %9d %15d %15d %15d %15d  %5s  %-10s %7d\n",
+			i+1, len(s.Blocks), s.Offset, s.UncompressedOffset, s.CompressedSize(),
+			s.UncompressedSize(), ratio(s.CompressedSize(), s.UncompressedSize()),
+			s.Header.Flags.CheckName(), s.Padding)
+	}
+
+	fmt.Fprintln(l.w, "  Blocks:")
+	header := "    Stream     Block      CompOffset    UncompOffset       TotalSize      UncompSize  Ratio  Check"
+	// the CheckVal column fits the largest check in the file
+	checkWidth := len("CheckVal")
+	for i := range streams {
+		if n := 2 * streams[i].Header.Flags.CheckSize(); n > checkWidth {
+			checkWidth = n
+		}
+	}
+	if l.verbosity >= 2 {
+		header += fmt.Sprintf("      %-*s  Header  Flags        CompSize    MemUsage  Filters", checkWidth, "CheckVal")
+	}
+	fmt.Fprintln(l.w, header)
+	for i := range streams {
+		s := &streams[i]
+		for j := range s.Blocks {
+			b := &s.Blocks[j]
+			fmt.Fprintf(l.w, "    %6d %9d %15d %15d %15d %15d  %5s  ",
+				i+1, j+1, b.Offset, b.UncompressedOffset, b.TotalSize(), b.UncompressedSize,
+				ratio(b.TotalSize(), b.UncompressedSize))
+			if l.verbosity >= 2 {
+				d := readBlockDetails(r, s, b)
+				fmt.Fprintf(l.w, "%-10s %-*s %7d  %-5s %15d %11s  %s\n",
+					s.Header.Flags.CheckName(), checkWidth, d.checkVal, d.headerSize, d.flags,
+					d.compressed, memory(d.memory), strings.Join(d.filters, " "))
+			} else {
+				fmt.Fprintln(l.w, s.Header.Flags.CheckName())
+			}
+		}
+	}
+}
+
+// blockDetails are the Block Header fields shown at verbosity 2.
+type blockDetails struct {
+	// checkVal is the Check as xz shows it, "---" if there is none
+	checkVal   string
+	headerSize int
+	// flags are "c" and "u" for the sizes stored in the header, or "-"
+	flags      string
+	compressed int64
+	memory     uint64
+	filters    []string
+}
+
+func readBlockDetails(r io.ReaderAt, s *xz.StreamInfo, b *xz.BlockInfo) blockDetails {
+	check, err := b.ReadCheck(r, s.Header.Flags)
+	if len(check) <= 8 {
+		// CRCs are stored little endian but shown as numbers
+		for i, j := 0, len(check)-1; i < j; i, j = i+1, j-1 {
+			check[i], check[j] = check[j], check[i]
+		}
+	}
+	checkVal := hex.EncodeToString(check)
+	if err != nil || len(check) == 0 {
+		checkVal = "---"
+	}
+
+	flags := []byte("--")
+	compressed, uncompressed := b.SizesInHeader()
+	if compressed {
+		flags[0] = 'c'
+	}
+	if uncompressed {
+		flags[1] = 'u'
+	}
+
+	var describe []string
+	chain, err := xz.NewFilterChain(b.Header.Filters())
+	if err != nil {
+		describe = []string{err.Error()}
+	}
+	for _, f := range chain {
+		describe = append(describe, filters.Describe(f))
+	}
+	return blockDetails{
+		checkVal:   checkVal,
+		headerSize: b.HeaderSize(),
+		flags:      string(flags),
+		compressed: b.CompressedSize(s.Header.Flags),
+		memory:     blockMemory(&b.Header),
+		filters:    describe,
+	}
+}
+
+func blockMemory(h *xz.BlockHeader) uint64 {
+	chain, err := xz.NewFilterChain(h.Filters())
+	if err != nil {
+		return 0
+	}
+	return filters.DecoderMemory(chain)
+}
+
+// niceSize formats a size like xz does, in bytes below 10000 and otherwise
+// with one decimal in the smallest binary unit that keeps it below 10000.
+func niceSize(n int64) string {
+	if n < 10000 {
+		return fmt.Sprintf("%d B", n)
+	}
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	size := float64(n) / xz.KiloByte
+	unit := 0
+	for size > 9999.9 && unit < len(units)-1 {
+		size /= xz.KiloByte
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// exactSize adds the exact size to niceSize when it was rounded.
+func exactSize(n int64) string {
+	if n < 10000 {
+		return niceSize(n)
+	}
+	return fmt.Sprintf("%s (%d B)", niceSize(n), n)
+}
+
+// memory rounds up to whole MiB.
+func memory(n uint64) string {
+	return fmt.Sprintf("%d MiB", (n+xz.MegaByte-1)/xz.MegaByte)
+}
+
+func ratio(compressed, uncompressed int64) string {
+	if uncompressed == 0 {
+		return "---"
+	}
+	r := float64(compressed) / float64(uncompressed)
+	if r > 9.999 {
+		return "---"
+	}
+	return fmt.Sprintf("%.3f", r)
+}
+
+func checkNames(checks [16]bool, sep string) string {
+	var names []string
+	for id, used := range checks {
+		if used {
+			flags := xz.StreamFlags{0, byte(id)}
+			names = append(names, flags.CheckName())
+		}
+	}
+	return strings.Join(names, sep)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
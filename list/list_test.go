@@ -0,0 +1,93 @@
+package list
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNiceSize(t *testing.T) {
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{0, "0 B"},
+		{9999, "9999 B"},
+		{10000, "9.8 KiB"},
+		{1137561, "1110.9 KiB"},
+		{10239897, "9999.9 KiB"},
+		{10240000, "9.8 MiB"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, niceSize(tt.size), tt.expected, "size %d", tt.size)
+	}
+}
+
+func TestList(t *testing.T) {
+	buf, err := ioutil.ReadFile("../test/test2.txt.multistream.xz")
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	l := NewLister(&out, 0, Text)
+	assert.Nil(t, l.List(bytes.NewReader(buf), int64(len(buf)), "multi.xz", 2))
+	assert.Nil(t, l.List(bytes.NewReader(buf), int64(len(buf)), "again.xz", 2))
+	l.Close()
+
+	// the same as xz -l shows
+	expected := `Strms  Blocks   Compressed Uncompressed  Ratio  Check   Filename
+    2       2     92.8 KiB    260.2 KiB  0.357  CRC64,SHA-256 multi.xz
+    2       2     92.8 KiB    260.2 KiB  0.357  CRC64,SHA-256 again.xz
+-------------------------------------------------------------------------------
+    4       4    185.6 KiB    520.4 KiB  0.357  CRC64,SHA-256 2 files
+`
+	assert.Equal(t, out.String(), expected, "list output")
+}
+
+func TestListRobot(t *testing.T) {
+	buf, err := ioutil.ReadFile("../test/test2.txt.multistream.xz")
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	l := NewLister(&out, 1, Robot)
+	assert.Nil(t, l.List(bytes.NewReader(buf), int64(len(buf)), "multi.xz", 1))
+	assert.Nil(t, l.Close())
+
+	// the same as xz --robot -lv shows
+	expected := "name\tmulti.xz\n" +
+		"file\t2\t2\t95020\t266462\t0.357\tCRC64,SHA-256\t8\n" +
+		"stream\t1\t1\t0\t0\t30676\t100000\t0.307\tSHA-256\t8\n" +
+		"stream\t2\t1\t30684\t100000\t64336\t166462\t0.386\tCRC64\t0\n" +
+		"block\t1\t1\t1\t12\t0\t30640\t100000\t0.306\tSHA-256\n" +
+		"block\t2\t1\t2\t30696\t100000\t64300\t166462\t0.386\tCRC64\n" +
+		"totals\t2\t2\t95020\t266462\t0.357\tCRC64,SHA-256\t8\t1\n"
+	assert.Equal(t, out.String(), expected, "robot output")
+	assert.Equal(t, robotVersion("5.4.0"), 50040002)
+}
+
+func TestListJSON(t *testing.T) {
+	buf, err := ioutil.ReadFile("../test/test2.txt.multistream.xz")
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	l := NewLister(&out, 0, JSON)
+	assert.Nil(t, l.List(bytes.NewReader(buf), int64(len(buf)), "multi.xz", 1))
+	assert.Nil(t, l.Close())
+
+	var report Report
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, len(report.Files), 1)
+	f := report.Files[0]
+	assert.Equal(t, f.Checks, []string{"CRC64", "SHA-256"})
+	assert.Equal(t, f.StreamPadding, int64(8))
+	assert.Equal(t, len(f.Streams), 2)
+	assert.Equal(t, f.Streams[1].Index, IndexReport{Records: 1, Size: 12})
+	b := f.Streams[1].Blocks[0]
+	assert.Equal(t, b.Number, 2, "blocks are numbered across the file")
+	assert.Equal(t, b.CheckValue, "b943f313600c42da", "the check is read even at verbosity 0")
+	assert.Equal(t, b.Filters, []string{"--lzma2=dict=256KiB"})
+	assert.Equal(t, report.Totals.Files, 1)
+	assert.Equal(t, report.Totals.UncompressedSize, int64(266462))
+}
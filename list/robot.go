@@ -0,0 +1,73 @@
+package list
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+// printRobot prints a file in the format of xz --robot --list: a name and a
+// file line, stream and block lines from verbosity 1 and a summary line at
+// verbosity 2. Fields are separated by tabs and sizes are in bytes.
+func (l *Lister) printRobot(r io.ReaderAt, name string, t totals, streams []xz.StreamInfo) {
+	fmt.Fprintf(l.w, "name\t%s\n", name)
+	fmt.Fprintf(l.w, "file\t%d\t%d\t%s\n", t.streams, t.blocks, robotSizes(t))
+	if l.verbosity < 1 {
+		return
+	}
+
+	for i := range streams {
+		s := &streams[i]
+		fmt.Fprintf(l.w, "stream\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%d\n",
+			i+1, len(s.Blocks), s.Offset, s.UncompressedOffset, s.CompressedSize(), s.UncompressedSize(),
+			ratio(s.CompressedSize(), s.UncompressedSize()), s.Header.Flags.CheckName(), s.Padding)
+	}
+	number := 0
+	for i := range streams {
+		s := &streams[i]
+		for j := range s.Blocks {
+			b := &s.Blocks[j]
+			number++
+			fmt.Fprintf(l.w, "block\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s",
+				i+1, j+1, number, b.Offset, b.UncompressedOffset, b.TotalSize(), b.UncompressedSize,
+				ratio(b.TotalSize(), b.UncompressedSize), s.Header.Flags.CheckName())
+			if l.verbosity >= 2 {
+				d := readBlockDetails(r, s, b)
+				fmt.Fprintf(l.w, "\t%s\t%d\t%s\t%d\t%d\t%s",
+					d.checkVal, d.headerSize, d.flags, d.compressed, d.memory, strings.Join(d.filters, " "))
+			}
+			fmt.Fprintln(l.w)
+		}
+	}
+	if l.verbosity >= 2 {
+		fmt.Fprintf(l.w, "summary\t%s\n", robotHeaderSummary(t))
+	}
+}
+
+func (l *Lister) printRobotTotals() {
+	t := l.total
+	fmt.Fprintf(l.w, "totals\t%d\t%d\t%s\t%d", t.streams, t.blocks, robotSizes(t), t.files)
+	if l.verbosity >= 2 {
+		fmt.Fprintf(l.w, "\t%s", robotHeaderSummary(t))
+	}
+	fmt.Fprintln(l.w)
+}
+
+func robotSizes(t totals) string {
+	return fmt.Sprintf("%d\t%d\t%s\t%s\t%d",
+		t.compressed, t.uncompressed, ratio(t.compressed, t.uncompressed), checkNames(t.checks, ","), t.padding)
+}
+
+func robotHeaderSummary(t totals) string {
+	return fmt.Sprintf("%d\t%s\t%d", t.memory, strings.ToLower(yesNo(t.sizesInHeaders)), robotVersion(t.minVersion))
+}
+
+// robotVersion encodes a version like xz does, 5.4.0 is 50040002 where the
+// final 2 marks a stable release.
+func robotVersion(version string) int {
+	var major, minor, patch int
+	fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch)
+	return major*10000000 + minor*10000 + patch*10 + 2
+}
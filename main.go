@@ -1,109 +1,404 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"strings"
 
 	"github.com/jessevdk/go-flags"
 
 	"github.com/ZymoticB/goxz/compress"
 	"github.com/ZymoticB/goxz/decompress"
+	"github.com/ZymoticB/goxz/inspect"
+	"github.com/ZymoticB/goxz/list"
 	"github.com/ZymoticB/goxz/output"
 	"github.com/ZymoticB/goxz/xz"
 )
 
 var errExit = errors.New("sentinel error used to exit cleanly")
+var errStdoutWithOutput = errors.New("--stdout can not be used with --output")
+var errMethodFlags = errors.New("--compress, --decompress, --test and --list can not be used together")
+var errNotXZ = errors.New("File format not recognized")
+var errListStdin = errors.New("--list does not support reading from standard input")
+var errFormatFlags = errors.New("--json and --robot can not be used together")
+var errFormatMethod = errors.New("--json and --robot are only supported by list, inspect and test")
+
+// Exit codes, the same as xz uses.
+const (
+	exitSuccess = 0
+	exitError   = 1
+	exitWarning = 2
+)
+
+// fileErrors is returned when some of the inputs could not be processed,
+// the error for each of them has already been printed.
+type fileErrors struct {
+	failed, skipped int
+}
+
+func (e fileErrors) Error() string {
+	return fmt.Sprintf("%d files failed, %d skipped", e.failed, e.skipped)
+}
+
+// isWarning tells whether err only caused an input to be skipped, which xz
+// treats as a warning rather than an error.
+func isWarning(err error) bool {
+	return err == errIsDirectory || err == errHasSuffix || err == errUnknownSuffix
+}
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	parseAndRun(output.ConsoleOutput{os.Stdout})
+	removeTempFilesOnSignal()
+	os.Exit(parseAndRun(os.Args[1:], os.Stdout, &output.ConsoleOutput{File: os.Stderr}))
 }
 
-func parseAndRun(out output.Output) {
-	opts, err := getOptions(os.Args[1:], out)
+// parseAndRun is the single exit point of goxz, it returns the exit code for
+// the result of running with args. Reports are written to stdout and
+// diagnostics to out.
+func parseAndRun(args []string, stdout io.Writer, out output.Output) int {
+	err := runArgs(args, stdout, out)
+	if err == nil || err == errExit {
+		return exitSuccess
+	}
+	if e, ok := err.(fileErrors); ok {
+		if e.failed == 0 {
+			return exitWarning
+		}
+		return exitError
+	}
+	out.Errorf("goxz: %v\n", err)
+	return exitError
+}
+
+func runArgs(args []string, stdout io.Writer, out output.Output) error {
+	opts, err := getOptions(args, out)
 	if err != nil {
 		if err == errExit {
-			return
+			return err
 		}
-		out.Fatalf("Failed to parse options: %v", err)
+		return fmt.Errorf("Failed to parse options: %v", err)
 	}
-	runWithOptions(*opts, out)
+	out.SetLevel(opts.GOpts.Level())
+	return runWithOptions(*opts, stdout, out)
 }
 
-func getMethod(opts Options, out output.Output) string {
+// getMethod returns the method to run, which unless given is decided by
+// whether the input starts with the xz magic bytes. The bytes are only
+// peeked at, so they are still read by the method.
+func getMethod(opts Options, input *bufio.Reader) (string, error) {
 	method := opts.GOpts.Method
+	switch {
+	case opts.GOpts.Compress:
+		method = "compress"
+	case opts.GOpts.Decompress:
+		method = "decompress"
+	case opts.GOpts.Test:
+		method = "test"
+	case opts.GOpts.List:
+		method = "list"
+	}
 	if method != "" {
-		return method
+		return method, nil
 	}
 
-	// TODO: tylerd detect filetype based on magic rather than extension
-	// Will need to peek first 6 bytes and then stitch it back in, or maybe close the file
-	// instead of trying to pass a multiwriter all the way through to the xz module
-	inputFilePath := opts.FOpts.Input
-	outputFilePath := opts.FOpts.Output
-	out.Printf("inputPath: %s, outputPath: %s\n", inputFilePath, outputFilePath)
+	magic, err := input.Peek(xz.MagicSize)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if xz.IsXZ(magic) {
+		return "decompress", nil
+	}
+	return "compress", nil
+}
 
-	inputIsXZ := strings.HasSuffix(inputFilePath, ".xz")
-	outputIsXZ := strings.HasSuffix(outputFilePath, ".xz")
-	out.Printf("inputIsXZ: %v, outputIsXZ: %v\n", inputIsXZ, outputIsXZ)
+func isStdio(path string) bool {
+	return path == "" || path == "-"
+}
 
-	if inputIsXZ && outputIsXZ {
-		out.Fatal("Input and Output are both xz unable to determine method")
+func displayName(path string) string {
+	if isStdio(path) {
+		return "(stdin)"
 	}
+	return path
+}
 
-	if !inputIsXZ && !outputIsXZ {
-		out.Fatal("Neither Input or Output are xz format; unable to determine method")
+// openInput opens the input file, or returns standard input.
+func openInput(path string) (*os.File, error) {
+	if isStdio(path) {
+		return os.Stdin, nil
 	}
+	return os.Open(path)
+}
 
-	if inputIsXZ {
-		method = "decompress"
+// outputPath returns where the output of method run on input goes, "-" for
+// standard output.
+func outputPath(opts FileOptions, input, method string) (string, error) {
+	switch {
+	case opts.Stdout:
+		return "-", nil
+	case opts.Output != "":
+		return opts.Output, nil
+	case isStdio(input):
+		return "-", nil
 	}
+	return outputName(input, method)
+}
 
-	if outputIsXZ {
-		method = "compress"
+func runWithOptions(opts Options, stdout io.Writer, out output.Output) error {
+	config, err := opts.Filter.WriterConfig()
+	if err != nil {
+		return fmt.Errorf("Invalid filter chain: %v", err)
+	}
+	inputs := collectInputs(opts)
+	if len(inputs) > 1 && !isStdio(opts.FOpts.Output) {
+		return fmt.Errorf("Failed to parse options: %v", errOutputWithManyInputs)
 	}
-	return method
+
+	format := opts.GOpts.Format()
+	if opts.GOpts.List || opts.GOpts.Method == "list" {
+		return runList(opts, inputs, stdout, out, opts.GOpts.Verbosity())
+	}
+	if opts.GOpts.Method == "inspect" {
+		return runInspect(opts, inputs, stdout, out)
+	}
+	testing := opts.GOpts.Test || opts.GOpts.Method == "test"
+	if format != list.Text && !testing {
+		return errFormatMethod
+	}
+
+	var total summary
+	var report testReport
+	for _, input := range inputs {
+		var in, written int64
+		err := input.err
+		if err == nil {
+			in, written, err = processFile(opts, config, input.path, out)
+		}
+		printFileError(out, input.path, err)
+		total.add(in, written, err)
+		report.add(input.path, in, written, err)
+	}
+	if len(inputs) > 1 {
+		out.Infof("%s", total.String())
+	}
+	switch format {
+	case list.JSON:
+		err = report.write(stdout)
+	case list.Robot:
+		err = report.writeRobot(stdout)
+	}
+	if err != nil {
+		return err
+	}
+	return total.err()
 }
 
-func runWithOptions(opts Options, out output.Output) {
-	method := getMethod(opts, out)
+// printFileError prints what went wrong with an input, at LevelWarn if it
+// was only skipped.
+func printFileError(out output.Output, path string, err error) {
+	switch {
+	case err == nil:
+	case isWarning(err):
+		out.Warnf("%s: %v\n", displayName(path), err)
+	default:
+		out.Errorf("%s: %v\n", displayName(path), err)
+	}
+}
 
-	inputFilePath := opts.FOpts.Input
-	outputFilePath := opts.FOpts.Output
+// runList lists the inputs, which have to be files as the Index is read
+// from the end of each one.
+func runList(opts Options, inputs []inputPath, stdout io.Writer, out output.Output, verbosity int) error {
+	lister := list.NewLister(stdout, verbosity, opts.GOpts.Format())
+	var total summary
+	for _, input := range inputs {
+		err := input.err
+		if err == nil {
+			err = listFile(lister, input.path, len(inputs))
+		}
+		printFileError(out, input.path, err)
+		total.add(0, 0, err)
+	}
+	err := lister.Close()
+	if err != nil {
+		return err
+	}
+	return total.err()
+}
 
-	if method == "compress" {
-		err := compress.RunCompress(inputFilePath, outputFilePath)
+func listFile(lister *list.Lister, path string, count int) error {
+	if isStdio(path) {
+		return errListStdin
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errIsDirectory
+	}
+	return lister.List(f, info.Size(), path, count)
+}
+
+// processFile runs the method for one input and returns the number of bytes
+// read and written. Unless kept, input files are deleted once their output
+// file is written. With --verbose the progress is shown on console.
+func processFile(opts Options, config xz.WriterConfig, path string, console output.Output) (int64, int64, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if info.IsDir() {
+		return 0, 0, errIsDirectory
+	}
+
+	in := &countingReader{r: f}
+	input := bufio.NewReader(in)
+	method, err := getMethod(opts, input)
+	if err != nil {
+		return 0, 0, err
+	}
+	console.Debugf("%s: method %s\n", displayName(path), method)
+	if method != "compress" && method != "decompress" && method != "test" {
+		return 0, 0, fmt.Errorf("Unknown method %q", method)
+	}
+
+	// the output name is checked before the content, so that an unknown
+	// suffix is a warning like it is for xz
+	var destPath string
+	if method != "test" {
+		destPath, err = outputPath(opts.FOpts, path, method)
 		if err != nil {
-			out.Fatalf("Failed while running compress: %v", err)
-		} else {
-			os.Exit(0)
+			return 0, 0, err
+		}
+	}
+	if method == "test" || method == "decompress" {
+		magic, _ := input.Peek(xz.MagicSize)
+		if !xz.IsXZ(magic) {
+			return 0, 0, errNotXZ
+		}
+	}
+	var readerConfig xz.ReaderConfig
+	if opts.GOpts.Verbosity() > 0 && (method == "compress" || method == "decompress" || method == "test") {
+		var size int64
+		if f != os.Stdin && info.Mode().IsRegular() {
+			size = info.Size()
 		}
+		progress := newProgressReporter(console, displayName(path), method == "compress", size, isTerminal(os.Stderr))
+		config.Progress = progress.Update
+		readerConfig.Progress = progress.Update
+		defer progress.Done()
 	}
 
-	if method == "decompress" {
-		err := decompress.RunDecompress(inputFilePath, outputFilePath, out)
-		if err != nil {
-			out.Fatalf("Failed while running compress: %v", err)
-		} else {
-			os.Exit(0)
+	if method == "test" {
+		// decoding verifies every check, the data is only counted
+		out := &countingWriter{w: ioutil.Discard}
+		err = decompress.RunDecompress(input, out, readerConfig)
+		return in.n, out.n, err
+	}
+
+	if isStdio(destPath) {
+		console.Debugf("%s: writing to (stdout)\n", displayName(path))
+	} else {
+		console.Debugf("%s: writing to %s\n", displayName(path), destPath)
+		// with --force the input would be replaced by its output, and
+		// then removed
+		if destInfo, err := os.Stat(destPath); err == nil && os.SameFile(info, destInfo) {
+			return 0, 0, errOutputIsInput
 		}
 	}
+	dest, err := createOutput(destPath, opts.FOpts.Force)
+	if err != nil {
+		return 0, 0, err
+	}
+	out := &countingWriter{w: dest}
 
-	if method == "headers" {
-		inputIsXZ := strings.HasSuffix(inputFilePath, ".xz")
-		if inputIsXZ {
-			err := xz.OpenFile(inputFilePath)
-			if err != nil {
-				out.Fatalf("Failed while reading headers: %v", err)
-			}
-			os.Exit(0)
+	if method == "compress" {
+		if isTerminal(dest.File) && !opts.FOpts.Force {
+			err = errors.New("Compressed data can not be written to a terminal")
 		} else {
-			out.Fatalf("Headers command requires input file to be in xz format")
+			err = compress.RunCompress(input, out, config)
+		}
+	} else {
+		err = decompress.RunDecompress(input, out, readerConfig)
+	}
+	toFile := dest.File != os.Stdout
+	if err == nil && toFile && f != os.Stdin {
+		err = copyMetadata(info, dest.File)
+	}
+	if err != nil {
+		dest.Abort()
+		return in.n, out.n, err
+	}
+	err = dest.Commit()
+	if err == nil && toFile && f != os.Stdin && !opts.FOpts.Keep {
+		err = os.Remove(path)
+	}
+	return in.n, out.n, err
+}
+
+// runInspect dumps the structure of the inputs.
+func runInspect(opts Options, inputs []inputPath, stdout io.Writer, out output.Output) error {
+	inspector := inspect.NewInspector(stdout, opts.GOpts.Verbosity() > 0, opts.GOpts.Format())
+	var total summary
+	for _, input := range inputs {
+		err := input.err
+		if err == nil {
+			err = inspectFile(inspector, input.path)
 		}
+		printFileError(out, input.path, err)
+		total.add(0, 0, err)
+	}
+	err := inspector.Close()
+	if err != nil {
+		return err
+	}
+	return total.err()
+}
+
+// inspectFile inspects one input. Standard input is read into memory as the
+// raw bytes are read back from the file.
+func inspectFile(inspector *inspect.Inspector, path string) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errIsDirectory
 	}
 
+	var r io.ReaderAt = f
+	size := info.Size()
+	if f == os.Stdin {
+		buf, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(buf), int64(len(buf))
+	}
+	magic := make([]byte, xz.MagicSize)
+	n, _ := r.ReadAt(magic, 0)
+	if !xz.IsXZ(magic[:n]) {
+		return errNotXZ
+	}
+	return inspector.Inspect(r, size, displayName(path))
 }
 
 func newParser() (*flags.Parser, *Options) {
@@ -113,17 +408,12 @@ func newParser() (*flags.Parser, *Options) {
 
 func getOptions(args []string, out output.Output) (*Options, error) {
 	parser, opts := newParser()
-	parser.Usage = "-i <file>.xz -o <file> -m decompress"
+	parser.Usage = "[-d | -z | -t | -l] [-v] [--json | --robot] [-c] [-k] [-f] [-r] [-o <file>]"
 	parser.ShortDescription = "LZMA2 based [de]compressor"
 	parser.LongDescription = `
 goxz is a go implementation of LZMA2 which supports compressing and decompressing LZMA2 streams. Currently supports the xz file format
 `
 
-	if len(args) == 0 {
-		parser.WriteHelp(out)
-		return opts, errExit
-	}
-
 	_, err := parser.ParseArgs(args)
 	if err != nil {
 		if ferr, ok := err.(*flags.Error); ok {
@@ -135,5 +425,20 @@ goxz is a go implementation of LZMA2 which supports compressing and decompressin
 		return opts, err
 	}
 
+	if opts.FOpts.Stdout && !isStdio(opts.FOpts.Output) {
+		return opts, errStdoutWithOutput
+	}
+	methods := 0
+	for _, set := range []bool{opts.GOpts.Compress, opts.GOpts.Decompress, opts.GOpts.Test, opts.GOpts.List} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return opts, errMethodFlags
+	}
+	if opts.GOpts.JSON && opts.GOpts.Robot {
+		return opts, errFormatFlags
+	}
 	return opts, nil
 }
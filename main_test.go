@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/output"
+	"github.com/ZymoticB/goxz/xz"
+)
+
+func TestGetOptions(t *testing.T) {
+	tests := []struct {
+		args  []string
+		err   error
+		check func(opts *Options)
+	}{
+		{[]string{"-d", "-z"}, errMethodFlags, nil},
+		{[]string{"-t", "-l"}, errMethodFlags, nil},
+		{[]string{"-c", "-o", "out"}, errStdoutWithOutput, nil},
+		{[]string{"--json", "--robot", "-l"}, errFormatFlags, nil},
+		{[]string{"--help"}, errExit, nil},
+		{[]string{"-vv", "-k", "a", "b"}, nil, func(opts *Options) {
+			assert.Equal(t, opts.GOpts.Verbosity(), 2, "-vv")
+			assert.Equal(t, opts.GOpts.Level(), output.LevelDebug, "-vv")
+			assert.True(t, opts.FOpts.Keep, "-k")
+			assert.Equal(t, opts.Args.Files, []string{"a", "b"})
+		}},
+		{[]string{"-v", "-q"}, nil, func(opts *Options) {
+			assert.Equal(t, opts.GOpts.Verbosity(), 0, "--quiet overrides --verbose")
+			assert.Equal(t, opts.GOpts.Level(), output.LevelError, "-q")
+		}},
+	}
+	for _, tt := range tests {
+		var out output.BufferOutput
+		opts, err := getOptions(tt.args, &out)
+		assert.Equal(t, err, tt.err, "%v", tt.args)
+		if tt.check != nil {
+			tt.check(opts)
+		}
+	}
+
+	var out output.BufferOutput
+	getOptions([]string{"--help"}, &out)
+	assert.True(t, strings.Contains(out.String(), "Usage:"), "--help should print the usage")
+	assert.Equal(t, strings.Count(out.String(), "[FILE...]"), 1, "the arguments should be shown once")
+}
+
+func TestGetMethod(t *testing.T) {
+	fixture, err := ioutil.ReadFile("test/test1.txt.xz")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		args     []string
+		input    []byte
+		expected string
+	}{
+		{nil, fixture, "decompress"},
+		{nil, []byte("plain text"), "compress"},
+		{nil, nil, "compress"},
+		{[]string{"-z"}, fixture, "compress"},
+		{[]string{"-d"}, []byte("plain text"), "decompress"},
+		{[]string{"-t"}, fixture, "test"},
+		{[]string{"-m", "inspect"}, fixture, "inspect"},
+	}
+	for _, tt := range tests {
+		opts, err := getOptions(tt.args, &output.BufferOutput{})
+		assert.Nil(t, err)
+		input := bufio.NewReader(bytes.NewReader(tt.input))
+		method, err := getMethod(*opts, input)
+		assert.Nil(t, err)
+		assert.Equal(t, method, tt.expected, "%v", tt.args)
+
+		rest, _ := ioutil.ReadAll(input)
+		assert.Equal(t, len(rest), len(tt.input), "the input should only be peeked at")
+	}
+}
+
+func TestRunWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goxz")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	expected, err := ioutil.ReadFile("test/test1.txt")
+	assert.Nil(t, err)
+	out := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		err    error
+		stderr string
+		// output is compared with test1.txt once decompressed
+		output string
+	}{
+		{"decompress", []string{"-d", "-k", "-o", out("1.txt"), "test/test1.txt.xz"}, nil, "", out("1.txt")},
+		{"compress", []string{"-z", "-k", "-o", out("2.xz"), "test/test1.txt"}, nil, "", out("2.xz")},
+		{"detect xz", []string{"-k", "-o", out("3.txt"), "test/test1.txt.xz"}, nil, "", out("3.txt")},
+		{"test", []string{"-t", "test/test1.txt.xz", "test/test2.txt.multistream.xz"}, nil,
+			"2 files, 0 failed, 0 skipped: 95092 bytes in, 266477 bytes out, ratio 2.802\n", ""},
+		{"test not xz", []string{"-t", "test/test1.txt"}, fileErrors{failed: 1},
+			"test/test1.txt: File format not recognized\n", ""},
+		{"existing output", []string{"-d", "-k", "-o", out("1.txt"), "test/test1.txt.xz"}, fileErrors{failed: 1},
+			"test/test1.txt.xz: Output file exists, use --force to overwrite it\n", ""},
+		{"directory", []string{"-t", dir}, fileErrors{skipped: 1}, dir + ": Is a directory, skipping\n", ""},
+		{"unknown suffix", []string{"-d", "test/test1.txt"}, fileErrors{skipped: 1},
+			"test/test1.txt: Filename has an unknown suffix, skipping\n", ""},
+		{"quiet", []string{"-q", "-t", dir}, fileErrors{skipped: 1}, "", ""},
+	}
+	for _, tt := range tests {
+		var stderr output.BufferOutput
+		opts, err := getOptions(tt.args, &stderr)
+		assert.Nil(t, err, tt.name)
+		stderr.SetLevel(opts.GOpts.Level())
+		err = runWithOptions(*opts, ioutil.Discard, &stderr)
+		assert.Equal(t, err, tt.err, tt.name)
+		assert.Equal(t, stderr.String(), tt.stderr, tt.name)
+		if tt.output != "" {
+			assert.Equal(t, decompressed(t, tt.output), expected, tt.name)
+		}
+	}
+
+	// -vv adds the debug lines before the progress
+	stderr := &output.BufferOutput{}
+	assert.Nil(t, runArgs([]string{"-vv", "-d", "-k", "-o", out("4.txt"), "test/test1.txt.xz"}, ioutil.Discard, stderr))
+	debug := "test/test1.txt.xz: method decompress\ntest/test1.txt.xz: writing to " + out("4.txt") + "\n"
+	assert.True(t, strings.HasPrefix(stderr.String(), debug), "debug output: %q", stderr.String())
+
+	err = runArgs([]string{"-o", out("5"), "a", "b"}, ioutil.Discard, &output.BufferOutput{})
+	assert.Equal(t, err.Error(), "Failed to parse options: "+errOutputWithManyInputs.Error())
+
+	// standard output stays open for each of the inputs
+	stdout := os.Stdout
+	os.Stdout, err = os.Create(out("6.txt"))
+	assert.Nil(t, err)
+	err = runArgs([]string{"-d", "-c", "test/test1.txt.xz", "test/test1.txt.xz"}, ioutil.Discard, &output.BufferOutput{})
+	os.Stdout.Close()
+	os.Stdout = stdout
+	assert.Nil(t, err, "-c with several inputs")
+	assert.Equal(t, decompressed(t, out("6.txt")), bytes.Repeat(expected, 2), "-c with several inputs")
+
+	// --force must not replace the input with its own output
+	fixture, err := ioutil.ReadFile("test/test1.txt.xz")
+	assert.Nil(t, err)
+	for _, args := range [][]string{{"-d", "-f", "-o", out("same.xz")}, {"-z", "-f", "-o", out("same.xz")}} {
+		assert.Nil(t, ioutil.WriteFile(out("same.xz"), fixture, 0644))
+		stderr = &output.BufferOutput{}
+		err = runArgs(append(args, out("same.xz")), ioutil.Discard, stderr)
+		assert.Equal(t, err, fileErrors{failed: 1}, "%v", args)
+		assert.Equal(t, stderr.String(), out("same.xz")+": "+errOutputIsInput.Error()+"\n", "%v", args)
+		kept, err := ioutil.ReadFile(out("same.xz"))
+		assert.Nil(t, err, "%v", args)
+		assert.Equal(t, kept, fixture, "%v", args)
+	}
+}
+
+// decompressed reads the file, decompressing it if it is xz.
+func decompressed(t *testing.T, path string) []byte {
+	buf, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	if !xz.IsXZ(buf) {
+		return buf
+	}
+	r, err := xz.NewReader(bytes.NewReader(buf))
+	assert.Nil(t, err)
+	buf, err = ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	return buf
+}
+
+func TestParseAndRunExitCodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goxz")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	missing := filepath.Join(dir, "missing.xz")
+	notFound := missing + ": open " + missing + ": no such file or directory\n"
+
+	tests := []struct {
+		args     []string
+		expected int
+		// errors are the messages printed at LevelError
+		errors []string
+	}{
+		{[]string{"--help"}, exitSuccess, nil},
+		{[]string{"-t", "test/test1.txt.xz"}, exitSuccess, nil},
+		{[]string{"--bogus"}, exitError, []string{"goxz: Failed to parse options: unknown flag `bogus'\n"}},
+		{[]string{"-t", missing}, exitError, []string{notFound}},
+		{[]string{"-t", dir}, exitWarning, nil},
+		{[]string{"-t", dir, missing}, exitError, []string{notFound}},
+	}
+	for _, tt := range tests {
+		var out output.BufferOutput
+		assert.Equal(t, parseAndRun(tt.args, ioutil.Discard, &out), tt.expected, "%v", tt.args)
+		assert.Equal(t, out.Errors(), tt.errors, "%v", tt.args)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	defer null.Close()
+	assert.False(t, isTerminal(null), "%s is not a terminal", os.DevNull)
+}
+
+func TestTestReportRobot(t *testing.T) {
+	var report testReport
+	report.add("a.xz", 72, 15, nil)
+	report.add("b", 0, 0, errNotXZ)
+	var out bytes.Buffer
+	assert.Nil(t, report.writeRobot(&out))
+	assert.Equal(t, out.String(), "file\ta.xz\tok\t72\t15\t\n"+
+		"file\tb\tfailed\t0\t0\t"+errNotXZ.Error()+"\n"+
+		"totals\t2\t1\t72\t15\n")
+
+	out.Reset()
+	args := []string{"-t", "--robot", "test/test1.txt.xz", "test/test1.txt"}
+	err := runArgs(args, &out, &output.BufferOutput{})
+	assert.Equal(t, err, fileErrors{failed: 1})
+	assert.Equal(t, out.String(), "file\ttest/test1.txt.xz\tok\t72\t15\t\n"+
+		"file\ttest/test1.txt\tfailed\t0\t0\t"+errNotXZ.Error()+"\n"+
+		"totals\t2\t1\t72\t15\n", "%v", args)
+
+	err = runArgs([]string{"-d", "--robot", "test/test1.txt.xz"}, ioutil.Discard, &output.BufferOutput{})
+	assert.Equal(t, err, errFormatMethod, "decompress has no robot form")
+}
+
+func TestTestReportJSON(t *testing.T) {
+	var out bytes.Buffer
+	args := []string{"-t", "--json", "test/test1.txt.xz", "test/test1.txt"}
+	err := runArgs(args, &out, &output.BufferOutput{})
+	assert.Equal(t, err, fileErrors{failed: 1})
+	assert.Equal(t, out.String(), `{
+  "files": [
+    {
+      "name": "test/test1.txt.xz",
+      "ok": true,
+      "compressed_size": 72,
+      "uncompressed_size": 15
+    },
+    {
+      "name": "test/test1.txt",
+      "ok": false,
+      "error": "`+errNotXZ.Error()+`",
+      "compressed_size": 0,
+      "uncompressed_size": 0
+    }
+  ]
+}
+`, "%v", args)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+)
+
+// copyMetadata gives the output file the permissions, owner and timestamps
+// of the input like xz does. Changing the owner usually needs privileges, so
+// like xz a failure to do so is ignored, but the permissions are then
+// limited to the owner.
+func copyMetadata(info os.FileInfo, dest *os.File) error {
+	mode := info.Mode().Perm()
+	if uid, gid, ok := fileOwner(info); ok {
+		if dest.Chown(uid, gid) != nil {
+			mode &= 0700
+		}
+	}
+	err := dest.Chmod(mode)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dest.Name(), accessTime(info), info.ModTime())
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// fileOwner is only known on Linux, elsewhere the output keeps the owner of
+// the user running goxz.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -1,20 +1,153 @@
 package main
 
+import (
+	"strings"
+
+	"github.com/ZymoticB/goxz/list"
+	"github.com/ZymoticB/goxz/output"
+	"github.com/ZymoticB/goxz/xz"
+	"github.com/ZymoticB/goxz/xz/filters"
+)
+
 type Options struct {
-	FOpts FileOptions    `group:"file"`
-	GOpts GeneralOptions `group:"general"`
+	FOpts  FileOptions    `group:"file"`
+	GOpts  GeneralOptions `group:"general"`
+	Filter FilterOptions  `group:"filters"`
+	Args   struct {
+		Files []string `positional-arg-name:"FILE" description:"Files to process, standard input is read if none or - are given"`
+	} `positional-args:"yes"`
 }
 
 type FileOptions struct {
-	Input  string `short:"i" long:"input" description:"Path to input file"`
-	Output string `short:"o" long:"output" description:"Path to output file"`
+	Input     string `short:"i" long:"input" description:"Path to an input file, in addition to any FILE arguments"`
+	Output    string `short:"o" long:"output" description:"Path to output file for a single input, - for standard output. Defaults to the input name with .xz added or removed"`
+	Stdout    bool   `short:"c" long:"stdout" description:"Write to standard output"`
+	Recursive bool   `short:"r" long:"recursive" description:"Process the files in directories"`
+	Keep      bool   `short:"k" long:"keep" description:"Keep the input files instead of deleting them after success"`
+	Force     bool   `short:"f" long:"force" description:"Overwrite existing output files and write compressed data to a terminal"`
 }
 
 type GeneralOptions struct {
-	Method string `short:"m" long:"method" description:"Method to perform on input, options are: compress, decompress. Defaults to decompress if the input file has a '.xz' postfix. Defaults to compress if the output file has a '.xz' postfix."`
+	Method     string `short:"m" long:"method" description:"Method to perform on input, options are: compress, decompress, test, list, inspect. Defaults to decompress if the input is in xz format and compress otherwise."`
+	Compress   bool   `short:"z" long:"compress" description:"Same as --method=compress"`
+	Decompress bool   `short:"d" long:"decompress" description:"Same as --method=decompress"`
+	Test       bool   `short:"t" long:"test" description:"Same as --method=test, decompresses and verifies the input without writing any output"`
+	List       bool   `short:"l" long:"list" description:"Same as --method=list, shows the Streams and Blocks of xz files without decompressing them"`
+	Verbose    []bool `short:"v" long:"verbose" description:"Show more detail, can be given twice"`
+	Quiet      bool   `short:"q" long:"quiet" description:"Only print errors, overrides --verbose"`
+	JSON       bool   `long:"json" description:"Print the result of list, inspect or test as JSON"`
+	Robot      bool   `long:"robot" description:"Print the result of list, inspect or test in tab separated form, list as xz --robot does"`
+}
+
+// Format is how the results of list, inspect and test are printed.
+func (o *GeneralOptions) Format() list.Format {
+	switch {
+	case o.JSON:
+		return list.JSON
+	case o.Robot:
+		return list.Robot
+	}
+	return list.Text
+}
+
+// Verbosity is the number of times --verbose was given, 0 if --quiet was.
+func (o *GeneralOptions) Verbosity() int {
+	if o.Quiet {
+		return 0
+	}
+	return len(o.Verbose)
+}
+
+// Level is the lowest level of diagnostics to print. Progress is shown at
+// LevelInfo with one --verbose, debugging needs two.
+func (o *GeneralOptions) Level() output.Level {
+	switch {
+	case o.Quiet:
+		return output.LevelError
+	case o.Verbosity() >= 2:
+		return output.LevelDebug
+	}
+	return output.LevelInfo
+}
+
+// FilterOptions select the filter chain used when compressing. Like xz, the
+// individual filter options build the chain in the order they are given,
+// --filters replaces anything before it and filters after it start over.
+type FilterOptions struct {
+	Filters func(string) `long:"filters" value-name:"FILTERS" description:"Filter chain to compress with, e.g. \"x86 lzma2:preset=9e,dict=64MiB\". Defaults to lzma2:preset=6"`
+
+	X86      func(string) `long:"x86" optional:"yes" optional-value:"" value-name:"start=N" description:"Add the x86 BCJ filter to the chain"`
+	PowerPC  func(string) `long:"powerpc" optional:"yes" optional-value:"" value-name:"start=N" description:"Add the PowerPC BCJ filter to the chain"`
+	IA64     func(string) `long:"ia64" optional:"yes" optional-value:"" value-name:"start=N" description:"Add the IA-64 BCJ filter to the chain"`
+	ARM      func(string) `long:"arm" optional:"yes" optional-value:"" value-name:"start=N" description:"Add the ARM BCJ filter to the chain"`
+	ARMThumb func(string) `long:"armthumb" optional:"yes" optional-value:"" value-name:"start=N" description:"Add the ARM-Thumb BCJ filter to the chain"`
+	ARM64    func(string) `long:"arm64" optional:"yes" optional-value:"" value-name:"start=N" description:"Add the ARM64 BCJ filter to the chain"`
+	SPARC    func(string) `long:"sparc" optional:"yes" optional-value:"" value-name:"start=N" description:"Add the SPARC BCJ filter to the chain"`
+	RISCV    func(string) `long:"riscv" optional:"yes" optional-value:"" value-name:"start=N" description:"Add the RISC-V BCJ filter to the chain"`
+	Delta    func(string) `long:"delta" optional:"yes" optional-value:"" value-name:"dist=N" description:"Add the delta filter to the chain"`
+	LZMA2    func(string) `long:"lzma2" optional:"yes" optional-value:"" value-name:"OPTS" description:"Add the LZMA2 filter to the chain, OPTS are preset, dict, lc, lp, pb, mode, nice and depth"`
+
+	AutoFilters bool `long:"auto-filters" description:"Add the BCJ filter for the executables found in each block to the chain"`
+
+	specs []string
+	full  bool
+}
+
+func (o *FilterOptions) setChain(spec string) {
+	o.specs = []string{spec}
+	o.full = true
+}
+
+func (o *FilterOptions) add(name string) func(string) {
+	return func(options string) {
+		if o.full {
+			o.specs = nil
+			o.full = false
+		}
+		spec := name
+		if options != "" {
+			spec += ":" + options
+		}
+		o.specs = append(o.specs, spec)
+	}
+}
+
+// autoFiltersBlockSize is the block size used with --auto-filters, small
+// enough that the executables in an archive get blocks of their own.
+const autoFiltersBlockSize = 8 * xz.MegaByte
+
+// WriterConfig returns the compression settings selected by the options.
+func (o *FilterOptions) WriterConfig() (xz.WriterConfig, error) {
+	spec := "lzma2:preset=6"
+	if len(o.specs) > 0 {
+		spec = strings.Join(o.specs, " ")
+	}
+	chain, err := filters.ParseFilterChain(spec)
+	if err != nil {
+		return xz.WriterConfig{}, err
+	}
+
+	config := xz.WriterConfig{Filters: chain}
+	if o.AutoFilters {
+		config.SelectFilters = filters.NewAutoFilters(chain).Select
+		config.BlockSize = autoFiltersBlockSize
+	}
+	return config, nil
 }
 
 func newOptions() *Options {
 	var opts Options
+	f := &opts.Filter
+	f.Filters = f.setChain
+	f.X86 = f.add("x86")
+	f.PowerPC = f.add("powerpc")
+	f.IA64 = f.add("ia64")
+	f.ARM = f.add("arm")
+	f.ARMThumb = f.add("armthumb")
+	f.ARM64 = f.add("arm64")
+	f.SPARC = f.add("sparc")
+	f.RISCV = f.add("riscv")
+	f.Delta = f.add("delta")
+	f.LZMA2 = f.add("lzma2")
 	return &opts
 }
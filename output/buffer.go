@@ -0,0 +1,56 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// BufferOutput keeps everything printed in memory, for tests. Like
+// ConsoleOutput it drops diagnostics below its Level. Error messages are
+// also recorded on their own.
+type BufferOutput struct {
+	bytes.Buffer
+	Level Level
+
+	errors []string
+}
+
+// Errors returns the messages printed with Errorf, in order.
+func (b *BufferOutput) Errors() []string {
+	return b.errors
+}
+
+func (b *BufferOutput) SetLevel(level Level) {
+	b.Level = level
+}
+
+func (b *BufferOutput) Print(args ...interface{}) {
+	fmt.Fprint(b, args...)
+}
+
+func (b *BufferOutput) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(b, format, args...)
+}
+
+func (b *BufferOutput) Debugf(format string, args ...interface{}) {
+	b.logf(LevelDebug, format, args...)
+}
+
+func (b *BufferOutput) Infof(format string, args ...interface{}) {
+	b.logf(LevelInfo, format, args...)
+}
+
+func (b *BufferOutput) Warnf(format string, args ...interface{}) {
+	b.logf(LevelWarn, format, args...)
+}
+
+func (b *BufferOutput) Errorf(format string, args ...interface{}) {
+	b.errors = append(b.errors, fmt.Sprintf(format, args...))
+	b.logf(LevelError, format, args...)
+}
+
+func (b *BufferOutput) logf(level Level, format string, args ...interface{}) {
+	if level >= b.Level {
+		b.Printf(format, args...)
+	}
+}
@@ -0,0 +1,30 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferOutputLevels(t *testing.T) {
+	tests := []struct {
+		level    Level
+		expected string
+	}{
+		{LevelDebug, "print debug info warn error "},
+		{LevelInfo, "print info warn error "},
+		{LevelWarn, "print warn error "},
+		{LevelError, "print error "},
+	}
+	for _, tt := range tests {
+		var out BufferOutput
+		out.SetLevel(tt.level)
+		out.Print("print ")
+		out.Debugf("%s ", "debug")
+		out.Infof("%s ", "info")
+		out.Warnf("%s ", "warn")
+		out.Errorf("%s ", "error")
+		assert.Equal(t, out.String(), tt.expected, "level %d", tt.level)
+		assert.Equal(t, out.Errors(), []string{"error "}, "level %d", tt.level)
+	}
+}
@@ -23,35 +23,68 @@ package output
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 )
 
+// Level is how important a diagnostic is, the zero value is LevelInfo.
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Output is where diagnostics go. Print and Printf are always shown, the
+// leveled methods only when the level has been set at or below theirs.
 type Output interface {
 	io.Writer
 
-	Fatal(v ...interface{})
 	Print(v ...interface{})
-	Fatalf(format string, args ...interface{})
 	Printf(format string, args ...interface{})
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	SetLevel(level Level)
 }
 
 type ConsoleOutput struct {
 	*os.File
+	Level Level
+}
+
+func (c *ConsoleOutput) SetLevel(level Level) {
+	c.Level = level
+}
+
+func (c *ConsoleOutput) Debugf(format string, args ...interface{}) {
+	c.logf(LevelDebug, format, args...)
+}
+
+func (c *ConsoleOutput) Infof(format string, args ...interface{}) {
+	c.logf(LevelInfo, format, args...)
+}
+
+func (c *ConsoleOutput) Warnf(format string, args ...interface{}) {
+	c.logf(LevelWarn, format, args...)
 }
 
-func (ConsoleOutput) Fatal(v ...interface{}) {
-	log.Fatal(v...)
+func (c *ConsoleOutput) Errorf(format string, args ...interface{}) {
+	c.logf(LevelError, format, args...)
 }
 
-func (ConsoleOutput) Fatalf(format string, args ...interface{}) {
-	log.Fatalf(format, args...)
+func (c *ConsoleOutput) logf(level Level, format string, args ...interface{}) {
+	if level >= c.Level {
+		c.Printf(format, args...)
+	}
 }
 
-func (ConsoleOutput) Printf(format string, args ...interface{}) {
-	fmt.Printf(format, args...)
+func (c *ConsoleOutput) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(c.File, format, args...)
 }
 
-func (ConsoleOutput) Print(args ...interface{}) {
-	fmt.Print(args...)
+func (c *ConsoleOutput) Print(args ...interface{}) {
+	fmt.Fprint(c.File, args...)
 }
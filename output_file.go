@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// tempFiles are the temporary output files not yet renamed into place, they
+// are removed if goxz is interrupted.
+var tempFiles = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// removeTempFilesOnSignal removes the temporary files on SIGINT or SIGTERM
+// so that no truncated output is ever left behind.
+func removeTempFilesOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		tempFiles.Lock()
+		for path := range tempFiles.paths {
+			os.Remove(path)
+		}
+		os.Exit(1)
+	}()
+}
+
+// outputFile is standard output or a temporary file in the directory of the
+// output, which Commit renames to the output's name once it is complete.
+type outputFile struct {
+	*os.File
+	path string // "" for standard output
+}
+
+// createOutput creates the output file, or returns standard output. Existing
+// files are only replaced with force set.
+func createOutput(path string, force bool) (*outputFile, error) {
+	if isStdio(path) {
+		return &outputFile{File: os.Stdout}, nil
+	}
+	if _, err := os.Lstat(path); err == nil && !force {
+		return nil, errOutputExists
+	}
+
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	dir, base := filepath.Split(path)
+	for i := 0; ; i++ {
+		temp := filepath.Join(dir, fmt.Sprintf(".%s.%d.%d.tmp", base, os.Getpid(), i))
+		f, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tempFiles.paths[temp] = true
+		return &outputFile{File: f, path: path}, nil
+	}
+}
+
+// Commit syncs the output to disk and renames it into place. Standard output
+// is left open for the next input.
+func (o *outputFile) Commit() error {
+	if o.path == "" {
+		return nil
+	}
+	err := o.Sync()
+	if closeErr := o.Close(); err == nil {
+		err = closeErr
+	}
+
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	if err == nil {
+		err = os.Rename(o.Name(), o.path)
+	}
+	if err != nil {
+		os.Remove(o.Name())
+	}
+	delete(tempFiles.paths, o.Name())
+	return err
+}
+
+// Abort removes the incomplete output.
+func (o *outputFile) Abort() {
+	if o.path == "" {
+		return
+	}
+	o.Close()
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	os.Remove(o.Name())
+	delete(tempFiles.paths, o.Name())
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ZymoticB/goxz/output"
+	"github.com/ZymoticB/goxz/xz"
+)
+
+const (
+	// terminalInterval is how often the progress line is redrawn on a
+	// terminal, logInterval how often a line is logged otherwise.
+	terminalInterval = 250 * time.Millisecond
+	logInterval      = 5 * time.Second
+)
+
+// progressReporter shows the progress of one file on a single line that is
+// redrawn on a terminal, or logged every logInterval when it is not.
+type progressReporter struct {
+	out      output.Output
+	name     string
+	compress bool
+	// size of the input, 0 if it is not known
+	size     int64
+	terminal bool
+	now      func() time.Time
+
+	start, last time.Time
+	latest      xz.Progress
+	// width of the line on the terminal, to blank what a shorter line
+	// leaves behind
+	width int
+}
+
+func newProgressReporter(out output.Output, name string, compress bool, size int64, terminal bool) *progressReporter {
+	p := &progressReporter{
+		out:      out,
+		name:     name,
+		compress: compress,
+		size:     size,
+		terminal: terminal,
+		now:      time.Now,
+	}
+	p.start = p.now()
+	p.last = p.start
+	return p
+}
+
+// Update is an xz.ProgressFunc, it only prints when the interval has passed.
+func (p *progressReporter) Update(progress xz.Progress) {
+	p.latest = progress
+	interval := logInterval
+	if p.terminal {
+		interval = terminalInterval
+	}
+	now := p.now()
+	if now.Sub(p.last) < interval {
+		return
+	}
+	p.last = now
+	p.print(now, false)
+}
+
+// Done prints the final progress of the file.
+func (p *progressReporter) Done() {
+	p.print(p.now(), true)
+}
+
+func (p *progressReporter) print(now time.Time, done bool) {
+	line := p.line(now)
+	if !p.terminal {
+		p.out.Infof("%s\n", line)
+		return
+	}
+	padding := ""
+	if len(line) < p.width {
+		padding = strings.Repeat(" ", p.width-len(line))
+	}
+	p.width = len(line)
+	end := ""
+	if done {
+		end = "\n"
+	}
+	p.out.Infof("\r%s%s%s", line, padding, end)
+}
+
+// line formats the progress like "name: 42.0 %, 10.0 MiB in, 2.5 MiB out,
+// ratio 0.250, 20.3 MB/s, 0:02 left". The percentage and time left are only
+// known for inputs of known size.
+func (p *progressReporter) line(now time.Time) string {
+	in, out := p.latest.Compressed, p.latest.Uncompressed
+	if p.compress {
+		in, out = out, in
+	}
+	parts := []string{fmt.Sprintf("%s:", p.name)}
+	if p.size > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f %%,", 100*float64(in)/float64(p.size)))
+	}
+	parts = append(parts, fmt.Sprintf("%s in, %s out,", formatBytes(in), formatBytes(out)))
+
+	ratio := "---"
+	if p.latest.Uncompressed > 0 {
+		ratio = fmt.Sprintf("%.3f", float64(p.latest.Compressed)/float64(p.latest.Uncompressed))
+	}
+	parts = append(parts, fmt.Sprintf("ratio %s,", ratio))
+
+	elapsed := now.Sub(p.start).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(in) / elapsed
+	}
+	parts = append(parts, fmt.Sprintf("%.1f MB/s", rate/1e6))
+	if p.size > 0 && rate > 0 && in < p.size {
+		left := time.Duration(float64(p.size-in) / rate * float64(time.Second))
+		parts[len(parts)-1] += ","
+		parts = append(parts, formatDuration(left)+" left")
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= xz.GigaByte:
+		return fmt.Sprintf("%.1f GiB", float64(n)/xz.GigaByte)
+	case n >= xz.MegaByte:
+		return fmt.Sprintf("%.1f MiB", float64(n)/xz.MegaByte)
+	case n >= xz.KiloByte:
+		return fmt.Sprintf("%.1f KiB", float64(n)/xz.KiloByte)
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// formatDuration rounds up to whole seconds as h:mm:ss or m:ss.
+func formatDuration(d time.Duration) string {
+	s := int64((d + time.Second - 1) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+func TestProgressLine(t *testing.T) {
+	start := time.Unix(0, 0)
+	tests := []struct {
+		name     string
+		compress bool
+		size     int64
+		progress xz.Progress
+		line     string
+	}{
+		{"compress", true, 4e6, xz.Progress{Compressed: 5e5, Uncompressed: 2e6},
+			"f: 50.0 %, 1.9 MiB in, 488.3 KiB out, ratio 0.250, 1.0 MB/s, 0:02 left"},
+		{"decompress", false, 1e6, xz.Progress{Compressed: 1e6, Uncompressed: 4e6},
+			"f: 100.0 %, 976.6 KiB in, 3.8 MiB out, ratio 0.250, 0.5 MB/s"},
+		{"unknown size", false, 0, xz.Progress{Compressed: 100, Uncompressed: 0},
+			"f: 100 B in, 0 B out, ratio ---, 0.0 MB/s"},
+	}
+	for _, tt := range tests {
+		p := &progressReporter{name: "f", compress: tt.compress, size: tt.size, start: start, latest: tt.progress}
+		assert.Equal(t, p.line(start.Add(2*time.Second)), tt.line, tt.name)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, formatDuration(1500*time.Millisecond), "0:02", "rounds up")
+	assert.Equal(t, formatDuration(3725*time.Second), "1:02:05", "hours")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// testReport is the output of --test --json:
+//
+//	{"files": [{"name": "a.xz", "ok": true, "compressed_size": 72, "uncompressed_size": 15}, ...]}
+//
+// Files that failed have "ok": false and an "error", their sizes are how far
+// the test got.
+//
+// With --robot there is a tab separated line per file and one for the totals:
+//
+//	file	<name>	<ok|failed>	<compressed size>	<uncompressed size>	<error>
+//	totals	<files>	<failed>	<compressed size>	<uncompressed size>
+type testReport struct {
+	Files []testResult `json:"files"`
+}
+
+type testResult struct {
+	Name             string `json:"name"`
+	OK               bool   `json:"ok"`
+	Error            string `json:"error,omitempty"`
+	CompressedSize   int64  `json:"compressed_size"`
+	UncompressedSize int64  `json:"uncompressed_size"`
+}
+
+func (r *testReport) add(path string, in, out int64, err error) {
+	result := testResult{Name: displayName(path), OK: err == nil, CompressedSize: in, UncompressedSize: out}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.Files = append(r.Files, result)
+}
+
+func (r *testReport) write(w io.Writer) error {
+	if r.Files == nil {
+		r.Files = []testResult{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *testReport) writeRobot(w io.Writer) error {
+	var failed int
+	var compressed, uncompressed int64
+	for _, f := range r.Files {
+		status := "ok"
+		if !f.OK {
+			status = "failed"
+			failed++
+		}
+		compressed += f.CompressedSize
+		uncompressed += f.UncompressedSize
+		_, err := fmt.Fprintf(w, "file\t%s\t%s\t%d\t%d\t%s\n", f.Name, status, f.CompressedSize, f.UncompressedSize, f.Error)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "totals\t%d\t%d\t%d\t%d\n", len(r.Files), failed, compressed, uncompressed)
+	return err
+}
@@ -0,0 +1,21 @@
+#!/bin/bash
+# Regenerates the expected BCJ filter output in test/bcj from the raw inputs
+# using the reference implementation in xz-utils. The LZMA2 stage is only
+# there because xz refuses a chain that does not end in it; decoding with
+# LZMA2 alone leaves the BCJ encoded bytes behind.
+
+set -e
+
+DIR=test/bcj
+ARCHS="$*"
+if [[ -z "$ARCHS" ]]; then
+	ARCHS=$(ls "$DIR"/*.bin | xargs -n1 basename | sed -e 's/\.bin$//')
+fi
+
+for arch in $ARCHS; do
+	for start in 0 65536; do
+		xz --format=raw --$arch=start=$start --lzma2=preset=0 -c "$DIR/$arch.bin" \
+			| xz --decompress --format=raw --lzma2=preset=0 -c \
+			> "$DIR/$arch.start$start.bcj"
+	done
+done
@@ -1,7 +1,30 @@
 package xz
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"io"
+	"io/ioutil"
+)
+
+var errBadBlockHeaderCRC = errors.New("Block header CRC32 does not match")
+var errBlockHeaderReserved = errors.New("Reserved Block Flags in use")
+var errBlockHeaderTooSmall = errors.New("Block header is too small for its fields")
+var errBlockHeaderPadding = errors.New("Block header padding is not null")
+var errBlockPadding = errors.New("Block padding is not null")
+var errBlockCompressedSize = errors.New("Block compressed size does not match its header")
+var errBlockUncompressedSize = errors.New("Block uncompressed size does not match its header")
+var errBlockHeaderTooLarge = errors.New("Block header is larger than 1024 bytes")
+
+const blockHeaderMaxSize = 1024
+
+const (
+	blockFlagsFilterCount      = 0x03
+	blockFlagsReserved         = 0x3C
+	blockFlagsCompressedSize   = 0x40
+	blockFlagsUncompressedSize = 0x80
 )
 
 type FilterFlags struct {
@@ -31,8 +54,338 @@ type Block struct {
 	CompressedData []byte
 	Padding        []byte
 	Check          []byte // variable length, sie and type depends on Stream Flags
+
+	// record is the Index Record of the Block once it has been read.
+	record IndexRecord
+}
+
+func (b *Block) read(br *bufio.Reader, flags StreamFlags) error {
+	var compressed bytes.Buffer
+	r, err := newBlockReader(br, flags, b)
+	if err != nil {
+		return err
+	}
+	r.cr.record = &compressed
+
+	_, err = io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return err
+	}
+	b.CompressedData = compressed.Bytes()
+	b.record = r.record()
+	return nil
+}
+
+func (flags *FilterFlags) read(r io.Reader) error {
+	err := flags.ID.Read(r)
+	if err != nil {
+		return err
+	}
+	err = flags.Size.Read(r)
+	if err != nil {
+		return err
+	}
+	if flags.Size > blockHeaderMaxSize {
+		return errBlockHeaderTooSmall
+	}
+	flags.Properties = make([]byte, flags.Size)
+	_, err = io.ReadFull(r, flags.Properties)
+	return err
+}
+
+func (flags *FilterFlags) write(w io.Writer) error {
+	err := flags.ID.Write(w)
+	if err != nil {
+		return err
+	}
+	err = flags.Size.Write(w)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(flags.Properties)
+	return err
+}
+
+func (h *BlockHeader) getRealSize() int {
+	return (int(h.EncodedSize[0]) + 1) * 4
+}
+
+// Size is the size of the Block Header in bytes.
+func (h *BlockHeader) Size() int {
+	return h.getRealSize()
+}
+
+// HasSizes tells whether the Block Header stores the compressed and
+// uncompressed sizes of the Block.
+func (h *BlockHeader) HasSizes() (compressed, uncompressed bool) {
+	return h.hasCompressedSize(), h.hasUncompressedSize()
+}
+
+func (h *BlockHeader) numFilters() int {
+	return int(h.Flags&blockFlagsFilterCount) + 1
+}
+
+func (h *BlockHeader) hasCompressedSize() bool {
+	return h.Flags&blockFlagsCompressedSize != 0
+}
+
+func (h *BlockHeader) hasUncompressedSize() bool {
+	return h.Flags&blockFlagsUncompressedSize != 0
+}
+
+// Filters returns the Filter Flags of the filters the Block uses.
+func (h *BlockHeader) Filters() []FilterFlags {
+	return h.FilterFlags[:h.numFilters()]
 }
 
-func (b *Block) read(r io.Reader) error {
+// read parses a Block Header, the first byte of which must not be the Index
+// Indicator.
+func (h *BlockHeader) read(r io.Reader) error {
+	_, err := io.ReadFull(r, h.EncodedSize[:])
+	if err != nil {
+		return err
+	}
+
+	raw := make([]byte, h.getRealSize())
+	raw[0] = h.EncodedSize[0]
+	_, err = io.ReadFull(r, raw[1:])
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	crcOffset := len(raw) - 4
+	h.CRC32 = CRC32(binary.LittleEndian.Uint32(raw[crcOffset:]))
+	if CRC32(Crc32(raw, crcOffset, 0)) != h.CRC32 {
+		return errBadBlockHeaderCRC
+	}
+
+	h.Flags = raw[1]
+	if h.Flags&blockFlagsReserved != 0 {
+		return errBlockHeaderReserved
+	}
+
+	fields := bytes.NewReader(raw[2:crcOffset])
+	if h.hasCompressedSize() {
+		err = h.CompressedSize.Read(fields)
+		if err != nil {
+			return errBlockHeaderTooSmall
+		}
+	}
+	if h.hasUncompressedSize() {
+		err = h.UncompressedSize.Read(fields)
+		if err != nil {
+			return errBlockHeaderTooSmall
+		}
+	}
+	for i := 0; i < h.numFilters(); i++ {
+		err = h.FilterFlags[i].read(fields)
+		if err != nil {
+			return errBlockHeaderTooSmall
+		}
+	}
+
+	h.Padding = raw[crcOffset-fields.Len() : crcOffset]
+	for _, b := range h.Padding {
+		if b != 0x00 {
+			return errBlockHeaderPadding
+		}
+	}
+	return nil
+}
+
+// write stores the Block Header, filling in its EncodedSize, Padding and
+// CRC32 from the other fields.
+func (h *BlockHeader) write(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteByte(0x00) // the size is filled in below
+	buf.WriteByte(h.Flags)
+	if h.hasCompressedSize() {
+		err := h.CompressedSize.Write(&buf)
+		if err != nil {
+			return err
+		}
+	}
+	if h.hasUncompressedSize() {
+		err := h.UncompressedSize.Write(&buf)
+		if err != nil {
+			return err
+		}
+	}
+	for _, f := range h.Filters() {
+		err := f.write(&buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	size := (buf.Len() + 4 + 3) &^ 3
+	if size > blockHeaderMaxSize {
+		return errBlockHeaderTooLarge
+	}
+	h.Padding = make([]byte, size-4-buf.Len())
+	buf.Write(h.Padding)
+
+	raw := buf.Bytes()
+	h.EncodedSize[0] = byte(size/4 - 1)
+	raw[0] = h.EncodedSize[0]
+	h.CRC32 = CRC32(Crc32(raw, len(raw), 0))
+	err := binary.Write(&buf, binary.LittleEndian, h.CRC32)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// countingReader counts the compressed bytes of a Block as they are read,
+// optionally stopping at the size given in the Block Header.
+type countingReader struct {
+	br     *bufio.Reader
+	n      int64
+	limit  int64 // -1 if unknown
+	record *bytes.Buffer
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.limit >= 0 {
+		if c.n >= c.limit {
+			return 0, io.EOF
+		}
+		if int64(len(p)) > c.limit-c.n {
+			p = p[:c.limit-c.n]
+		}
+	}
+	n, err := c.br.Read(p)
+	c.n += int64(n)
+	if c.record != nil {
+		c.record.Write(p[:n])
+	}
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	if c.limit >= 0 && c.n >= c.limit {
+		return 0, io.EOF
+	}
+	b, err := c.br.ReadByte()
+	if err != nil {
+		return b, err
+	}
+	c.n++
+	if c.record != nil {
+		c.record.WriteByte(b)
+	}
+	return b, nil
+}
+
+// blockReader decodes the data of a single Block. Once the filter chain
+// reports the end of the data the Block Padding and Check are read into the
+// Block and the sizes and Check are compared against what was decoded.
+type blockReader struct {
+	block     *Block
+	checkSize int
+	check     Check // nil if the check type is not supported
+
+	br           *bufio.Reader
+	cr           *countingReader
+	r            io.Reader
+	uncompressed int64
+	err          error
+}
+
+func newBlockReader(br *bufio.Reader, flags StreamFlags, block *Block) (*blockReader, error) {
+	err := block.Header.read(br)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := NewFilterChain(block.Header.Filters())
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &countingReader{br: br, limit: -1}
+	if block.Header.hasCompressedSize() {
+		cr.limit = int64(block.Header.CompressedSize)
+	}
+	r, err := chain.NewReader(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	// unsupported checks are skipped like xz does, their size is still known
+	check, err := NewCheck(flags)
+	if err == nil {
+		r = io.TeeReader(r, check)
+	}
+
+	return &blockReader{
+		block:     block,
+		checkSize: flags.getCheckSize(),
+		check:     check,
+		br:        br,
+		cr:        cr,
+		r:         r,
+	}, nil
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.r.Read(p)
+	b.uncompressed += int64(n)
+	if err == io.EOF {
+		err = b.finish()
+		if err == nil {
+			err = io.EOF
+		}
+	}
+	b.err = err
+	return n, err
+}
+
+// unpaddedSize is the size of the Block as recorded in the Index.
+func (b *blockReader) unpaddedSize() int64 {
+	return int64(b.block.Header.getRealSize()) + b.cr.n + int64(b.checkSize)
+}
+
+// record is the Index Record of the Block, once it has been read.
+func (b *blockReader) record() IndexRecord {
+	return IndexRecord{
+		UnpaddedSize:     MultiByteInteger(b.unpaddedSize()),
+		UncompressedSize: MultiByteInteger(b.uncompressed),
+	}
+}
+
+func (b *blockReader) finish() error {
+	header := &b.block.Header
+	if header.hasCompressedSize() && int64(header.CompressedSize) != b.cr.n {
+		return errBlockCompressedSize
+	}
+	if header.hasUncompressedSize() && int64(header.UncompressedSize) != b.uncompressed {
+		return errBlockUncompressedSize
+	}
+
+	b.block.Padding = make([]byte, (4-b.cr.n%4)%4)
+	_, err := io.ReadFull(b.br, b.block.Padding)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	for _, p := range b.block.Padding {
+		if p != 0x00 {
+			return errBlockPadding
+		}
+	}
+
+	b.block.Check = make([]byte, b.checkSize)
+	_, err = io.ReadFull(b.br, b.block.Check)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if b.check != nil && !bytes.Equal(b.check.Sum(), b.block.Check) {
+		return errBlockCheck
+	}
 	return nil
 }
@@ -0,0 +1,161 @@
+package xz
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+)
+
+var errUnsupportedCheck = errors.New("Stream uses an unsupported check type")
+var errBlockCheck = errors.New("Block check does not match its data")
+
+// Check computes the integrity check stored after each Block from the
+// uncompressed data written to it.
+type Check interface {
+	io.Writer
+
+	Reset()
+	// Size is the length of the check in bytes.
+	Size() int
+	// Sum returns the check as it is stored in the Block.
+	Sum() []byte
+}
+
+// NewCheck creates the Check selected by the Stream Flags.
+func NewCheck(flags StreamFlags) (Check, error) {
+	typ, err := flags.getCheckType()
+	if err != nil {
+		return nil, errUnsupportedCheck
+	}
+
+	switch typ {
+	case checkCRC32:
+		return &hashCheck{NewCRC32(), true}, nil
+	case checkCRC64:
+		return &hashCheck{NewCRC64(), true}, nil
+	case checkSHA256:
+		return &hashCheck{sha256.New(), false}, nil
+	}
+	return noCheck{}, nil
+}
+
+type noCheck struct{}
+
+func (noCheck) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (noCheck) Reset() {}
+
+func (noCheck) Size() int {
+	return 0
+}
+
+func (noCheck) Sum() []byte {
+	return nil
+}
+
+// hashCheck is a Check computed by a hash.Hash. The CRCs are stored little
+// endian, while hash.Hash32 and hash.Hash64 return big endian sums.
+type hashCheck struct {
+	h            hash.Hash
+	littleEndian bool
+}
+
+func (c *hashCheck) Write(p []byte) (int, error) {
+	return c.h.Write(p)
+}
+
+func (c *hashCheck) Reset() {
+	c.h.Reset()
+}
+
+func (c *hashCheck) Size() int {
+	return c.h.Size()
+}
+
+func (c *hashCheck) Sum() []byte {
+	sum := c.h.Sum(nil)
+	if c.littleEndian {
+		for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+			sum[i], sum[j] = sum[j], sum[i]
+		}
+	}
+	return sum
+}
+
+type crc32Hash struct {
+	crc uint32
+}
+
+// NewCRC32 returns a hash.Hash32 computing the CRC32 used by xz. Like
+// hash/crc32, Sum appends the CRC in big endian order.
+func NewCRC32() hash.Hash32 {
+	return new(crc32Hash)
+}
+
+func (h *crc32Hash) Write(p []byte) (int, error) {
+	h.crc = Crc32(p, len(p), h.crc)
+	return len(p), nil
+}
+
+func (h *crc32Hash) Sum(b []byte) []byte {
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], h.crc)
+	return append(b, sum[:]...)
+}
+
+func (h *crc32Hash) Sum32() uint32 {
+	return h.crc
+}
+
+func (h *crc32Hash) Reset() {
+	h.crc = 0
+}
+
+func (h *crc32Hash) Size() int {
+	return 4
+}
+
+func (h *crc32Hash) BlockSize() int {
+	return 1
+}
+
+type crc64Hash struct {
+	crc uint64
+}
+
+// NewCRC64 returns a hash.Hash64 computing the CRC64 used by xz. Like
+// hash/crc64, Sum appends the CRC in big endian order.
+func NewCRC64() hash.Hash64 {
+	return new(crc64Hash)
+}
+
+func (h *crc64Hash) Write(p []byte) (int, error) {
+	h.crc = Crc64(p, len(p), h.crc)
+	return len(p), nil
+}
+
+func (h *crc64Hash) Sum(b []byte) []byte {
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], h.crc)
+	return append(b, sum[:]...)
+}
+
+func (h *crc64Hash) Sum64() uint64 {
+	return h.crc
+}
+
+func (h *crc64Hash) Reset() {
+	h.crc = 0
+}
+
+func (h *crc64Hash) Size() int {
+	return 8
+}
+
+func (h *crc64Hash) BlockSize() int {
+	return 1
+}
@@ -0,0 +1,53 @@
+package xz
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCRCHash(t *testing.T) {
+	testString := []byte("this is a test\n")
+
+	var h32 hash.Hash32 = NewCRC32()
+	var h64 hash.Hash64 = NewCRC64()
+	w := io.MultiWriter(h32, h64)
+	w.Write(testString[:4])
+	w.Write(testString[4:])
+
+	assert.Equal(t, h32.Sum32(), uint32(0x72051312))
+	assert.Equal(t, h32.Sum([]byte{0xFF}), []byte{0xFF, 0x72, 0x05, 0x13, 0x12}, "Sum should append big endian")
+	assert.Equal(t, h64.Sum64(), uint64(0x643D26FB7156AB08))
+
+	h32.Reset()
+	h32.Write(testString)
+	assert.Equal(t, h32.Sum32(), uint32(0x72051312), "Reset should start over")
+}
+
+func TestNewCheck(t *testing.T) {
+	testString := []byte("this is a test\n")
+	sha := sha256.Sum256(testString)
+
+	tests := []struct {
+		flags    StreamFlags
+		expected []byte
+	}{
+		{StreamFlags{0x00, 0x00}, nil},
+		{StreamFlags{0x00, 0x01}, []byte{0x12, 0x13, 0x05, 0x72}},
+		{StreamFlags{0x00, 0x04}, []byte{0x08, 0xAB, 0x56, 0x71, 0xFB, 0x26, 0x3D, 0x64}},
+		{StreamFlags{0x00, 0x0A}, sha[:]},
+	}
+	for _, tt := range tests {
+		check, err := NewCheck(tt.flags)
+		assert.Nil(t, err)
+		check.Write(testString)
+		assert.Equal(t, check.Sum(), tt.expected, "check for flags %v should be stored little endian", tt.flags)
+		assert.Equal(t, check.Size(), tt.flags.getCheckSize())
+	}
+
+	_, err := NewCheck(StreamFlags{0x00, 0x02})
+	assert.Equal(t, err, errUnsupportedCheck)
+}
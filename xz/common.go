@@ -1,5 +1,14 @@
 package xz
 
-func OpenFile(inputPath string) error {
-	return nil
+import (
+	"io"
+)
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF for reads of
+// structures that must be complete.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
 }
@@ -0,0 +1,39 @@
+package xz
+
+import (
+	"context"
+	"fmt"
+)
+
+// contextCheckSize is how much a Writer compresses between checks of its
+// Context, about one LZMA2 chunk. A Reader checks on every Read.
+const contextCheckSize = 64 * KiloByte
+
+// CanceledError is returned by a Reader or Writer once its Context is done.
+type CanceledError struct {
+	// Err is the error of the Context.
+	Err error
+	// Progress is how far the Reader or Writer got.
+	Progress Progress
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("%v after %d uncompressed and %d compressed bytes",
+		e.Err, e.Progress.Uncompressed, e.Progress.Compressed)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// checkContext returns a CanceledError if ctx is set and done.
+func checkContext(ctx context.Context, progress Progress) error {
+	if ctx == nil {
+		return nil
+	}
+	err := ctx.Err()
+	if err != nil {
+		return &CanceledError{Err: err, Progress: progress}
+	}
+	return nil
+}
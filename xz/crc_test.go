@@ -11,16 +11,19 @@ http://tukaani.org/xz/xz-file-format.txt
 */
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCRC32(t *testing.T) {
-	//var table32 CRC32Table
-	//table32.calculateLookupTable()
-	// useful to generate lookup tables in a pasteable way
-
 	testString := []byte("this is a test\n")
 
 	crc32 := Crc32(testString, len(testString), 0)
@@ -29,13 +32,83 @@ func TestCRC32(t *testing.T) {
 }
 
 func TestCRC64(t *testing.T) {
-	//var table64 CRC64Table
-	//table64.init()
-	// useful to generate lookup tables in a pasteable way
-
 	testString := []byte("this is a test\n")
 
 	crc64 := Crc64(testString, len(testString), 0)
 
 	assert.Equal(t, crc64, uint64(0x643D26FB7156AB08))
 }
+
+func TestCRCTablesGenerated(t *testing.T) {
+	if testing.Short() {
+		t.Skip("running the generator is slow")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go tool is needed to run the generator")
+	}
+
+	dir, err := ioutil.TempDir("", "crc_tables")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "crc_tables.go")
+
+	out, err := exec.Command(goTool, "run", "mkcrctables.go", "-output", output).CombinedOutput()
+	assert.Nil(t, err, "generator failed: %s", out)
+	expected, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	actual, err := ioutil.ReadFile("crc_tables.go")
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(actual, expected), "crc_tables.go is out of date, run go generate")
+}
+
+func crcTestData(size int) []byte {
+	buf := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(buf)
+	return buf
+}
+
+func TestCRCSlicing(t *testing.T) {
+	buf := crcTestData(100)
+	for start := 0; start < 8; start++ {
+		for size := 0; size <= len(buf)-start; size++ {
+			p := buf[start:]
+			assert.Equal(t, Crc32(p, size, 0), crc32Bytewise(p, size, 0), "CRC32 of %d bytes at %d", size, start)
+			assert.Equal(t, Crc64(p, size, 0), crc64Bytewise(p, size, 0), "CRC64 of %d bytes at %d", size, start)
+		}
+	}
+
+	// a CRC can be continued across calls
+	assert.Equal(t, Crc32(buf[13:], 87, Crc32(buf, 13, 0)), Crc32(buf, 100, 0))
+	assert.Equal(t, Crc64(buf[13:], 87, Crc64(buf, 13, 0)), Crc64(buf, 100, 0))
+}
+
+var crcBenchmarkSizes = []int{64, 4 * KiloByte, 1 * MegaByte}
+
+func benchmarkCRC(b *testing.B, crc func([]byte, int) uint64) {
+	for _, size := range crcBenchmarkSizes {
+		buf := crcTestData(size)
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				crc(buf, size)
+			}
+		})
+	}
+}
+
+func BenchmarkCRC32(b *testing.B) {
+	benchmarkCRC(b, func(buf []byte, size int) uint64 { return uint64(Crc32(buf, size, 0)) })
+}
+
+func BenchmarkCRC32Bytewise(b *testing.B) {
+	benchmarkCRC(b, func(buf []byte, size int) uint64 { return uint64(crc32Bytewise(buf, size, 0)) })
+}
+
+func BenchmarkCRC64(b *testing.B) {
+	benchmarkCRC(b, func(buf []byte, size int) uint64 { return Crc64(buf, size, 0) })
+}
+
+func BenchmarkCRC64Bytewise(b *testing.B) {
+	benchmarkCRC(b, func(buf []byte, size int) uint64 { return crc64Bytewise(buf, size, 0) })
+}
@@ -0,0 +1,504 @@
+package xz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrNeedInput is returned by Decoder.Read once everything decoded so far has
+// been read. The readers of the filters return it when the Decoder has no
+// more input for them, reading again after more has been written continues
+// where they stopped.
+var ErrNeedInput = errors.New("More input is needed")
+
+var errDecoderClosed = errors.New("Decoder is already closed")
+var errDecoderFilter = errors.New("Decoder needs LZMA2 as the last filter")
+
+type decoderState int
+
+const (
+	decodeStreamHeader decoderState = iota
+	decodeBlockStart
+	decodeBlockHeader
+	decodeChunk
+	decodeBlockPadding
+	decodeCheck
+	decodeIndex
+	decodeFooter
+	decodeStreamPadding
+)
+
+// indexState is where the Decoder is in the Index.
+type indexState int
+
+const (
+	indexStateIndicator indexState = iota
+	indexStateCount
+	indexStateUnpadded
+	indexStateUncompressed
+	indexStatePadding
+	indexStateCRC
+)
+
+// Decoder decompresses xz data that is pushed to it with Write, without
+// blocking on a reader. It keeps its place in the data between writes, even
+// in the middle of a header, an integer or an LZMA2 chunk, so the input can
+// be split anywhere.
+//
+// The decoded data is passed to the output function given to NewDecoder, or
+// kept for Read if there is none.
+type Decoder struct {
+	output func(p []byte) error
+	out    bytes.Buffer
+	err    error
+	closed bool
+
+	state decoderState
+	// buf collects the structure being parsed until it has need bytes.
+	buf  []byte
+	need int
+
+	header  StreamHeader
+	records []IndexRecord
+	block   *pushBlock
+
+	index      Index
+	indexState indexState
+	indexCRC   uint32
+	indexSize  int
+	mb         multiByteDecoder
+	record     IndexRecord
+
+	padding int
+	scratch [32 * KiloByte]byte
+}
+
+// pushBlock is the Block being decoded. The LZMA2 chunk headers are parsed by
+// the Decoder, so that only whole chunks are passed to the filters.
+type pushBlock struct {
+	header       BlockHeader
+	source       pushSource
+	r            io.Reader
+	check        Check // nil if the check type is not supported
+	compressed   int64
+	uncompressed int64
+	// chunkData is set once the header of the current chunk is complete
+	chunkData bool
+	done      bool
+}
+
+// pushSource is the input of the filters, it holds the chunks written so far
+// and returns ErrNeedInput instead of blocking once they have been read.
+type pushSource struct {
+	buf []byte
+	off int
+}
+
+func (s *pushSource) Read(p []byte) (int, error) {
+	if s.off == len(s.buf) {
+		return 0, ErrNeedInput
+	}
+	n := copy(p, s.buf[s.off:])
+	s.off += n
+	return n, nil
+}
+
+func (s *pushSource) ReadByte() (byte, error) {
+	if s.off == len(s.buf) {
+		return 0, ErrNeedInput
+	}
+	s.off++
+	return s.buf[s.off-1], nil
+}
+
+func (s *pushSource) append(p []byte) {
+	if s.off == len(s.buf) {
+		s.buf, s.off = s.buf[:0], 0
+	}
+	s.buf = append(s.buf, p...)
+}
+
+// NewDecoder creates a Decoder that passes the decoded data to output, which
+// must not keep p. If output is nil the data is kept for Read instead.
+func NewDecoder(output func(p []byte) error) *Decoder {
+	return &Decoder{output: output, need: streamHeaderSize}
+}
+
+// Write decodes p, passing on everything that can be decoded so far. Unless
+// it returns an error all of p is used.
+func (d *Decoder) Write(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.closed {
+		return 0, errDecoderClosed
+	}
+	n := 0
+	for n < len(p) && d.err == nil {
+		var used int
+		used, d.err = d.step(p[n:])
+		n += used
+	}
+	return n, d.err
+}
+
+// Read reads the decoded data kept when there is no output function. It
+// returns ErrNeedInput when it has all been read, and io.EOF once the Decoder
+// has been closed as well.
+func (d *Decoder) Read(p []byte) (int, error) {
+	if d.out.Len() > 0 {
+		return d.out.Read(p)
+	}
+	switch {
+	case d.err != nil:
+		return 0, d.err
+	case d.closed:
+		return 0, io.EOF
+	}
+	return 0, ErrNeedInput
+}
+
+// Close tells the Decoder that the input has ended, which must be after a
+// whole Stream and its Stream Padding.
+func (d *Decoder) Close() error {
+	if d.err != nil {
+		return d.err
+	}
+	switch {
+	case d.state != decodeStreamPadding:
+		d.err = io.ErrUnexpectedEOF
+	case d.padding%4 != 0:
+		d.err = errStreamPadding
+	}
+	d.closed = true
+	return d.err
+}
+
+// fill adds to buf from p until it has need bytes.
+func (d *Decoder) fill(p []byte) (used int, full bool) {
+	used = d.need - len(d.buf)
+	if used > len(p) {
+		used = len(p)
+	}
+	d.buf = append(d.buf, p[:used]...)
+	return used, len(d.buf) == d.need
+}
+
+// next moves on to state, which needs the next need bytes.
+func (d *Decoder) next(state decoderState, need int) {
+	d.state = state
+	d.need = need
+	d.buf = d.buf[:0]
+}
+
+// step decodes the start of p, which is never empty, and returns how much of
+// it was used.
+func (d *Decoder) step(p []byte) (int, error) {
+	switch d.state {
+	case decodeBlockStart:
+		// the first byte is the Index Indicator or the Block Header size
+		if IndexIndicator(p[0]) == indexIndicator {
+			d.startIndex()
+			return 0, nil
+		}
+		d.next(decodeBlockHeader, (int(p[0])+1)*4)
+		return 0, nil
+	case decodeChunk:
+		return d.chunk(p)
+	case decodeIndex:
+		return d.indexBytes(p)
+	case decodeStreamPadding:
+		return d.streamPadding(p)
+	}
+
+	used, full := d.fill(p)
+	if !full {
+		return used, nil
+	}
+	var err error
+	switch d.state {
+	case decodeStreamHeader:
+		d.header = StreamHeader{}
+		err = d.header.read(bytes.NewReader(d.buf))
+		d.records = d.records[:0]
+		d.next(decodeBlockStart, 0)
+	case decodeBlockHeader:
+		err = d.startBlock()
+	case decodeBlockPadding:
+		if !bytes.Equal(d.buf, make([]byte, len(d.buf))) {
+			return used, errBlockPadding
+		}
+		d.next(decodeCheck, d.header.Flags.getCheckSize())
+	case decodeCheck:
+		err = d.finishBlock()
+	case decodeFooter:
+		var footer StreamFooter
+		err = footer.read(bytes.NewReader(d.buf))
+		if err == nil {
+			err = footer.validate(&d.header, &d.index)
+		}
+		d.padding = 0
+		d.next(decodeStreamPadding, 0)
+	}
+	return used, err
+}
+
+func (d *Decoder) startBlock() error {
+	b := &pushBlock{}
+	err := b.header.read(bytes.NewReader(d.buf))
+	if err != nil {
+		return err
+	}
+	chain, err := NewFilterChain(b.header.Filters())
+	if err != nil {
+		return err
+	}
+	if chain[len(chain)-1].ID() != FilterLZMA2 {
+		return errDecoderFilter
+	}
+	b.r, err = chain.NewReader(&b.source)
+	if err != nil {
+		return err
+	}
+	// unsupported checks are skipped like xz does
+	b.check, _ = NewCheck(d.header.Flags)
+	d.block = b
+	d.next(decodeChunk, 1)
+	return nil
+}
+
+// chunk collects an LZMA2 chunk, starting with its control byte which says
+// how long its header is, and decodes it once it is complete.
+func (d *Decoder) chunk(p []byte) (int, error) {
+	b := d.block
+	used, full := d.fill(p)
+	if !full {
+		return used, nil
+	}
+	if len(d.buf) == 1 {
+		d.need = lzma2ChunkHeaderSize(d.buf[0])
+		if d.need > 1 {
+			return used, nil
+		}
+	}
+	if !b.chunkData {
+		b.chunkData = true
+		d.need += lzma2ChunkDataSize(d.buf)
+		if len(d.buf) < d.need {
+			return used, nil
+		}
+	}
+
+	b.compressed += int64(len(d.buf))
+	if b.header.hasCompressedSize() && b.compressed > int64(b.header.CompressedSize) {
+		return used, errBlockCompressedSize
+	}
+	end := d.buf[0] == 0x00
+	b.source.append(d.buf)
+	err := d.decodeBlock()
+	if err != nil {
+		return used, err
+	}
+	b.chunkData = false
+	d.next(decodeChunk, 1)
+	if !end {
+		return used, nil
+	}
+
+	if !b.done {
+		return used, io.ErrUnexpectedEOF
+	}
+	if b.header.hasCompressedSize() && int64(b.header.CompressedSize) != b.compressed {
+		return used, errBlockCompressedSize
+	}
+	if b.header.hasUncompressedSize() && int64(b.header.UncompressedSize) != b.uncompressed {
+		return used, errBlockUncompressedSize
+	}
+	d.next(decodeBlockPadding, int((4-b.compressed%4)%4))
+	return used, nil
+}
+
+// lzma2ChunkHeaderSize is the size of the header of an LZMA2 chunk from its
+// control byte. Invalid control bytes are left to the LZMA2 filter.
+func lzma2ChunkHeaderSize(control byte) int {
+	switch {
+	case control >= 0xC0:
+		return 6 // sizes and properties
+	case control >= 0x80:
+		return 5
+	case control == 0x01 || control == 0x02:
+		return 3
+	}
+	return 1
+}
+
+// lzma2ChunkDataSize is the size of the data after the chunk header.
+func lzma2ChunkDataSize(header []byte) int {
+	switch {
+	case header[0] >= 0x80:
+		return int(binary.BigEndian.Uint16(header[3:5])) + 1
+	case header[0] == 0x01 || header[0] == 0x02:
+		return int(binary.BigEndian.Uint16(header[1:3])) + 1
+	}
+	return 0
+}
+
+// decodeBlock passes on everything the filters can decode from the chunks
+// written so far.
+func (d *Decoder) decodeBlock() error {
+	b := d.block
+	for !b.done {
+		n, err := b.r.Read(d.scratch[:])
+		if n > 0 {
+			b.uncompressed += int64(n)
+			if b.header.hasUncompressedSize() && b.uncompressed > int64(b.header.UncompressedSize) {
+				return errBlockUncompressedSize
+			}
+			if b.check != nil {
+				b.check.Write(d.scratch[:n])
+			}
+			if outErr := d.emit(d.scratch[:n]); outErr != nil {
+				return outErr
+			}
+		}
+		switch err {
+		case nil:
+		case ErrNeedInput:
+			return nil
+		case io.EOF:
+			b.done = true
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) emit(p []byte) error {
+	if d.output != nil {
+		return d.output(p)
+	}
+	d.out.Write(p)
+	return nil
+}
+
+func (d *Decoder) finishBlock() error {
+	b := d.block
+	if b.check != nil && !bytes.Equal(b.check.Sum(), d.buf) {
+		return errBlockCheck
+	}
+	d.records = append(d.records, IndexRecord{
+		UnpaddedSize:     MultiByteInteger(int64(b.header.getRealSize()) + b.compressed + int64(len(d.buf))),
+		UncompressedSize: MultiByteInteger(b.uncompressed),
+	})
+	d.block = nil
+	d.next(decodeBlockStart, 0)
+	return nil
+}
+
+func (d *Decoder) startIndex() {
+	d.index = Index{}
+	d.indexState = indexStateIndicator
+	d.indexCRC = 0
+	d.indexSize = 0
+	d.mb = multiByteDecoder{}
+	d.next(decodeIndex, 0)
+}
+
+// indexBytes parses the Index a byte at a time, as it has no fixed size.
+func (d *Decoder) indexBytes(p []byte) (int, error) {
+	for i, c := range p {
+		if d.indexState != indexStateCRC {
+			d.indexCRC = Crc32(p[i:], 1, d.indexCRC)
+			d.indexSize++
+		}
+		err := d.indexByte(c)
+		if err != nil || d.state != decodeIndex {
+			return i + 1, err
+		}
+	}
+	return len(p), nil
+}
+
+func (d *Decoder) indexByte(c byte) error {
+	var value MultiByteInteger
+	var done bool
+	var err error
+	switch d.indexState {
+	case indexStateCount, indexStateUnpadded, indexStateUncompressed:
+		value, done, err = d.mb.push(c)
+		if err != nil || !done {
+			return err
+		}
+	}
+
+	switch d.indexState {
+	case indexStateIndicator:
+		d.index.Indicator = IndexIndicator(c)
+		d.indexState = indexStateCount
+	case indexStateCount:
+		d.index.NumberOfRecords = value
+		if value != MultiByteInteger(len(d.records)) {
+			return errIndexRecords
+		}
+		d.indexState = indexStateUnpadded
+		if value == 0 {
+			d.endRecords()
+		}
+	case indexStateUnpadded:
+		d.record.UnpaddedSize = value
+		d.indexState = indexStateUncompressed
+	case indexStateUncompressed:
+		d.record.UncompressedSize = value
+		d.index.Records = append(d.index.Records, d.record)
+		d.indexState = indexStateUnpadded
+		if MultiByteInteger(len(d.index.Records)) == d.index.NumberOfRecords {
+			d.endRecords()
+		}
+	case indexStatePadding:
+		if c != 0x00 {
+			return errIndexPadding
+		}
+		d.index.Padding = append(d.index.Padding, c)
+		if d.indexSize%4 == 0 {
+			d.indexState = indexStateCRC
+		}
+	case indexStateCRC:
+		d.buf = append(d.buf, c)
+		if len(d.buf) < 4 {
+			return nil
+		}
+		d.index.CRC32 = CRC32(binary.LittleEndian.Uint32(d.buf))
+		if uint32(d.index.CRC32) != d.indexCRC {
+			return errBadIndexCRC
+		}
+		err = d.index.validate(d.records)
+		d.next(decodeFooter, streamFooterSize)
+	}
+	return err
+}
+
+func (d *Decoder) endRecords() {
+	d.indexState = indexStatePadding
+	if d.indexSize%4 == 0 {
+		d.indexState = indexStateCRC
+	}
+}
+
+// streamPadding skips null bytes up to the end of the input or the next
+// Stream Header.
+func (d *Decoder) streamPadding(p []byte) (int, error) {
+	for i, c := range p {
+		if c != 0x00 {
+			if d.padding%4 != 0 {
+				return i, errStreamPadding
+			}
+			d.next(decodeStreamHeader, streamHeaderSize)
+			return i, nil
+		}
+		d.padding++
+	}
+	return len(p), nil
+}
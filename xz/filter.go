@@ -0,0 +1,174 @@
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var errEmptyFilterChain = errors.New("Filter chain has no filters")
+var errTooManyFilters = errors.New("Filter chain has more than 4 filters")
+var errLZMA2NotLast = errors.New("LZMA2 can only be the last filter in a chain")
+
+// MaxFilters is the most filters a Block can use.
+const MaxFilters = 4
+
+// Filter IDs defined by the xz format.
+const (
+	FilterDelta    MultiByteInteger = 0x03
+	FilterX86      MultiByteInteger = 0x04
+	FilterPowerPC  MultiByteInteger = 0x05
+	FilterIA64     MultiByteInteger = 0x06
+	FilterARM      MultiByteInteger = 0x07
+	FilterARMThumb MultiByteInteger = 0x08
+	FilterSPARC    MultiByteInteger = 0x09
+	FilterARM64    MultiByteInteger = 0x0A
+	FilterRISCV    MultiByteInteger = 0x0B
+	FilterLZMA2    MultiByteInteger = 0x21
+)
+
+// Filter is one stage of a Block's filter chain. Decoders and encoders wrap
+// the next stage of the chain: the last filter reads or writes the Block's
+// compressed data, the first one sees the uncompressed data.
+type Filter interface {
+	// ID is the Filter ID stored in the Filter Flags.
+	ID() MultiByteInteger
+
+	// EncodeProperties returns the Filter Properties stored in the Filter
+	// Flags, which must be enough for a decoder to be created from.
+	EncodeProperties() []byte
+
+	// NewReader returns a reader of the data decoded from r.
+	NewReader(r io.Reader) (io.Reader, error)
+
+	// NewWriter returns a writer encoding everything written to it into w.
+	// Closing it must flush all buffered data and close w.
+	NewWriter(w io.WriteCloser) (io.WriteCloser, error)
+}
+
+// Releaser is implemented by filter writers that hold pooled buffers. Release
+// gives them back when the writer is abandoned without being closed, after
+// which the writer fails.
+type Releaser interface {
+	Release()
+}
+
+// FilterFactory creates a Filter from the Filter Properties of a Block.
+type FilterFactory func(props []byte) (Filter, error)
+
+var filterRegistry = struct {
+	sync.RWMutex
+	factories map[MultiByteInteger]FilterFactory
+}{factories: make(map[MultiByteInteger]FilterFactory)}
+
+// RegisterFilter makes a filter available for decoding Blocks that use the
+// given Filter ID. The filters defined by the xz format are registered by
+// importing github.com/ZymoticB/goxz/xz/filters. Like database/sql.Register it
+// panics if an ID is registered twice, it is meant to be called from init.
+func RegisterFilter(id MultiByteInteger, factory FilterFactory) {
+	filterRegistry.Lock()
+	defer filterRegistry.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("xz: RegisterFilter factory for filter 0x%x is nil", uint64(id)))
+	}
+	if _, dup := filterRegistry.factories[id]; dup {
+		panic(fmt.Sprintf("xz: RegisterFilter called twice for filter 0x%x", uint64(id)))
+	}
+	filterRegistry.factories[id] = factory
+}
+
+// NewFilter creates the registered Filter for the given Filter Flags.
+func NewFilter(flags FilterFlags) (Filter, error) {
+	filterRegistry.RLock()
+	factory, ok := filterRegistry.factories[flags.ID]
+	filterRegistry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unsupported filter ID 0x%x", uint64(flags.ID))
+	}
+	return factory(flags.Properties)
+}
+
+// FilterChain is the list of filters applied to a Block, in the order they are
+// stored in the Block Header. When encoding data passes through the first
+// filter first.
+type FilterChain []Filter
+
+// NewFilterChain creates the filters described by the Filter Flags of a Block
+// Header and validates the resulting chain.
+func NewFilterChain(flags []FilterFlags) (FilterChain, error) {
+	chain := make(FilterChain, 0, len(flags))
+	for _, f := range flags {
+		filter, err := NewFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, filter)
+	}
+	return chain, chain.Validate()
+}
+
+// Validate checks the rules the xz format puts on a chain: between 1 and 4
+// filters, and LZMA2 may only be used as the last one.
+func (c FilterChain) Validate() error {
+	if len(c) == 0 {
+		return errEmptyFilterChain
+	}
+	if len(c) > MaxFilters {
+		return errTooManyFilters
+	}
+	for _, f := range c[:len(c)-1] {
+		if f.ID() == FilterLZMA2 {
+			return errLZMA2NotLast
+		}
+	}
+	return nil
+}
+
+// Flags returns the Filter Flags to store in a Block Header for the chain.
+func (c FilterChain) Flags() []FilterFlags {
+	flags := make([]FilterFlags, len(c))
+	for i, f := range c {
+		props := f.EncodeProperties()
+		flags[i] = FilterFlags{
+			ID:         f.ID(),
+			Size:       MultiByteInteger(len(props)),
+			Properties: props,
+		}
+	}
+	return flags
+}
+
+// NewReader returns a reader of the data decoded by the whole chain from r,
+// which should be positioned at the start of a Block's compressed data.
+func (c FilterChain) NewReader(r io.Reader) (io.Reader, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	for i := len(c) - 1; i >= 0; i-- {
+		var err error
+		r, err = c[i].NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// NewWriter returns a writer that encodes data with the whole chain and
+// writes the result to w. Closing it closes w.
+func (c FilterChain) NewWriter(w io.WriteCloser) (io.WriteCloser, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	for i := len(c) - 1; i >= 0; i-- {
+		var err error
+		w, err = c[i].NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,117 @@
+package xz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testFilterID MultiByteInteger = 0x4000000000000000
+
+// xorFilter is a toy filter that XORs every byte with its only property.
+type xorFilter struct {
+	id  MultiByteInteger
+	key byte
+}
+
+func (f xorFilter) ID() MultiByteInteger {
+	return f.id
+}
+
+func (f xorFilter) EncodeProperties() []byte {
+	return []byte{f.key}
+}
+
+func (f xorFilter) NewReader(r io.Reader) (io.Reader, error) {
+	return &xorReader{r, f.key}, nil
+}
+
+func (f xorFilter) NewWriter(w io.WriteCloser) (io.WriteCloser, error) {
+	return &xorWriter{w, f.key}, nil
+}
+
+type xorReader struct {
+	r   io.Reader
+	key byte
+}
+
+func (x *xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= x.key
+	}
+	return n, err
+}
+
+type xorWriter struct {
+	io.WriteCloser
+	key byte
+}
+
+func (x *xorWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	for i, b := range p {
+		buf[i] = b ^ x.key
+	}
+	return x.WriteCloser.Write(buf)
+}
+
+func init() {
+	RegisterFilter(testFilterID, func(props []byte) (Filter, error) {
+		return xorFilter{testFilterID, props[0]}, nil
+	})
+}
+
+func TestFilterChainValidate(t *testing.T) {
+	f := xorFilter{testFilterID, 1}
+	lzma2 := xorFilter{FilterLZMA2, 1}
+
+	assert.Equal(t, FilterChain{}.Validate(), errEmptyFilterChain)
+	assert.Equal(t, FilterChain{f, f, f, f, f}.Validate(), errTooManyFilters)
+	assert.Equal(t, FilterChain{lzma2, f}.Validate(), errLZMA2NotLast)
+	assert.Nil(t, FilterChain{f, f, f, lzma2}.Validate())
+}
+
+func TestNewFilterChain(t *testing.T) {
+	flags := []FilterFlags{
+		{ID: testFilterID, Size: 1, Properties: []byte{0x0F}},
+		{ID: testFilterID, Size: 1, Properties: []byte{0xF0}},
+	}
+	chain, err := NewFilterChain(flags)
+	assert.Nil(t, err)
+	assert.Equal(t, chain, FilterChain{xorFilter{testFilterID, 0x0F}, xorFilter{testFilterID, 0xF0}}, "filters should be created in order")
+	assert.Equal(t, chain.Flags(), flags, "Filter Flags should round trip")
+
+	_, err = NewFilterChain([]FilterFlags{{ID: 0x7F}})
+	assert.NotNil(t, err, "unregistered filters should be rejected")
+}
+
+func TestRegisterFilterTwice(t *testing.T) {
+	assert.Panics(t, func() {
+		RegisterFilter(testFilterID, func(props []byte) (Filter, error) {
+			return nil, nil
+		})
+	})
+}
+
+func TestFilterChainRoundTrip(t *testing.T) {
+	chain := FilterChain{xorFilter{testFilterID, 0x0F}, xorFilter{testFilterID, 0x33}}
+	input := []byte("filter chains pass data through every filter")
+
+	var encoded bytes.Buffer
+	w, err := chain.NewWriter(nopWriteCloser{&encoded})
+	assert.Nil(t, err)
+	_, err = w.Write(input)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, encoded.Bytes()[0], input[0]^0x0F^0x33, "every filter should be applied")
+
+	r, err := chain.NewReader(&encoded)
+	assert.Nil(t, err)
+	decoded, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, decoded, input, "decoding should undo encoding")
+}
@@ -0,0 +1,210 @@
+package filters
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+var errInvalidBCJProperties = errors.New("BCJ filter properties must be empty or a 4 byte start offset")
+var errUnknownBCJArch = errors.New("Unknown BCJ filter architecture")
+
+const bcjBufferSize = 16 * xz.KiloByte
+
+// BCJArch selects the branch converter used by a BCJ filter. The values are
+// the filter IDs used for each architecture in the xz format.
+type BCJArch byte
+
+const (
+	BCJX86      BCJArch = 0x04
+	BCJPowerPC  BCJArch = 0x05
+	BCJIA64     BCJArch = 0x06
+	BCJARM      BCJArch = 0x07
+	BCJARMThumb BCJArch = 0x08
+	BCJSPARC    BCJArch = 0x09
+	BCJARM64    BCJArch = 0x0A
+	BCJRISCV    BCJArch = 0x0B
+)
+
+// BCJ is a Branch/Call/Jump filter. Relative branch targets in machine code
+// are converted to absolute addresses on encode, which makes repeated calls to
+// the same function look identical to LZMA2, and converted back on decode.
+type BCJ struct {
+	Arch BCJArch
+
+	// StartOffset is the position the first byte of the data is assumed to
+	// have, it must match between encoder and decoder.
+	StartOffset uint32
+}
+
+// bcjCoder converts the branch instructions in buf in place. pos is the
+// position of buf[0] in the filtered data. It returns how many bytes were
+// processed; anything after that may be a partial instruction and is offered
+// again at the start of the next call.
+type bcjCoder interface {
+	code(buf []byte, pos uint32, encoding bool) int
+}
+
+func (a BCJArch) newCoder() (bcjCoder, error) {
+	switch a {
+	case BCJX86:
+		return newX86Coder(), nil
+	case BCJPowerPC:
+		return powerPCCoder{}, nil
+	case BCJIA64:
+		return ia64Coder{}, nil
+	case BCJARM:
+		return armCoder{}, nil
+	case BCJARMThumb:
+		return armThumbCoder{}, nil
+	case BCJSPARC:
+		return sparcCoder{}, nil
+	case BCJARM64:
+		return arm64Coder{}, nil
+	case BCJRISCV:
+		return riscvCoder{}, nil
+	}
+	return nil, errUnknownBCJArch
+}
+
+func (f *BCJ) ID() xz.MultiByteInteger {
+	return xz.MultiByteInteger(f.Arch)
+}
+
+func (f *BCJ) EncodeProperties() []byte {
+	if f.StartOffset == 0 {
+		return nil
+	}
+	props := make([]byte, 4)
+	binary.LittleEndian.PutUint32(props, f.StartOffset)
+	return props
+}
+
+func (f *BCJ) DecodeProperties(props []byte) error {
+	switch len(props) {
+	case 0:
+		f.StartOffset = 0
+	case 4:
+		f.StartOffset = binary.LittleEndian.Uint32(props)
+	default:
+		return errInvalidBCJProperties
+	}
+	return nil
+}
+
+// NewReader returns a reader that decodes the BCJ filtered data read from r.
+func (f *BCJ) NewReader(r io.Reader) (io.Reader, error) {
+	coder, err := f.Arch.newCoder()
+	if err != nil {
+		return nil, err
+	}
+	return &bcjReader{
+		r:     r,
+		coder: coder,
+		pos:   f.StartOffset,
+		buf:   make([]byte, bcjBufferSize),
+	}, nil
+}
+
+// NewWriter returns a writer that BCJ encodes everything written to it before
+// passing it on to w. Closing the writer flushes any buffered data and closes w.
+func (f *BCJ) NewWriter(w io.WriteCloser) (io.WriteCloser, error) {
+	coder, err := f.Arch.newCoder()
+	if err != nil {
+		return nil, err
+	}
+	return &bcjWriter{
+		w:     w,
+		coder: coder,
+		pos:   f.StartOffset,
+		buf:   make([]byte, bcjBufferSize),
+	}, nil
+}
+
+type bcjReader struct {
+	r     io.Reader
+	coder bcjCoder
+	pos   uint32
+	err   error
+
+	// buf[start:conv] is decoded and waiting to be read, buf[conv:end] has
+	// been read from r but not decoded yet.
+	buf   []byte
+	start int
+	conv  int
+	end   int
+}
+
+func (br *bcjReader) Read(p []byte) (int, error) {
+	for br.start == br.conv {
+		if br.err == xz.ErrNeedInput {
+			// the Decoder has more input to come, read again then
+			br.err = nil
+			return 0, xz.ErrNeedInput
+		}
+		if br.err != nil {
+			if br.err == io.EOF && br.conv < br.end {
+				// Trailing bytes too short to be an instruction are
+				// passed through unchanged.
+				br.conv = br.end
+				break
+			}
+			return 0, br.err
+		}
+
+		br.end = copy(br.buf, br.buf[br.start:br.end])
+		br.start, br.conv = 0, 0
+
+		n, err := br.r.Read(br.buf[br.end:])
+		br.end += n
+		br.err = err
+
+		processed := br.coder.code(br.buf[:br.end], br.pos, false)
+		br.conv = processed
+		br.pos += uint32(processed)
+	}
+
+	n := copy(p, br.buf[br.start:br.conv])
+	br.start += n
+	return n, nil
+}
+
+type bcjWriter struct {
+	w     io.WriteCloser
+	coder bcjCoder
+	pos   uint32
+
+	// buf[:end] has been written but not encoded yet.
+	buf []byte
+	end int
+}
+
+func (bw *bcjWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(bw.buf[bw.end:], p)
+		bw.end += n
+		p = p[n:]
+		written += n
+
+		processed := bw.coder.code(bw.buf[:bw.end], bw.pos, true)
+		bw.pos += uint32(processed)
+		if _, err := bw.w.Write(bw.buf[:processed]); err != nil {
+			return written, err
+		}
+		bw.end = copy(bw.buf, bw.buf[processed:bw.end])
+	}
+	return written, nil
+}
+
+func (bw *bcjWriter) Close() error {
+	if bw.end > 0 {
+		if _, err := bw.w.Write(bw.buf[:bw.end]); err != nil {
+			return err
+		}
+		bw.end = 0
+	}
+	return bw.w.Close()
+}
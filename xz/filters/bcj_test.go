@@ -0,0 +1,115 @@
+package filters
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+The expected output in test/bcj was produced by xz-utils, see
+scripts/bcj-fixtures.sh. Each input ends with a few bytes that are too short to
+be an instruction so that passing through the tail is covered too.
+*/
+
+var bcjFixtures = []struct {
+	name string
+	arch BCJArch
+}{
+	{"x86", BCJX86},
+	{"powerpc", BCJPowerPC},
+	{"ia64", BCJIA64},
+	{"arm", BCJARM},
+	{"armthumb", BCJARMThumb},
+	{"sparc", BCJSPARC},
+	{"arm64", BCJARM64},
+	{"riscv", BCJRISCV},
+}
+
+var bcjStartOffsets = []uint32{0, 65536}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func readBCJFixture(t *testing.T, name string) []byte {
+	buf, err := ioutil.ReadFile("../../test/bcj/" + name)
+	assert.Nil(t, err)
+	return buf
+}
+
+func TestBCJEncode(t *testing.T) {
+	for _, fixture := range bcjFixtures {
+		for _, start := range bcjStartOffsets {
+			input := readBCJFixture(t, fixture.name+".bin")
+			expected := readBCJFixture(t, fmt.Sprintf("%s.start%d.bcj", fixture.name, start))
+
+			var out bytes.Buffer
+			f := BCJ{Arch: fixture.arch, StartOffset: start}
+			w, err := f.NewWriter(nopWriteCloser{&out})
+			assert.Nil(t, err)
+
+			// odd sized writes so instructions straddle Write calls
+			for len(input) > 0 {
+				n := 7
+				if n > len(input) {
+					n = len(input)
+				}
+				_, err = w.Write(input[:n])
+				assert.Nil(t, err)
+				input = input[n:]
+			}
+			assert.Nil(t, w.Close())
+
+			assert.Equal(t, out.Bytes(), expected, "%s encoding with start offset %d should match xz-utils", fixture.name, start)
+		}
+	}
+}
+
+func TestBCJDecode(t *testing.T) {
+	for _, fixture := range bcjFixtures {
+		for _, start := range bcjStartOffsets {
+			expected := readBCJFixture(t, fixture.name+".bin")
+			input := readBCJFixture(t, fmt.Sprintf("%s.start%d.bcj", fixture.name, start))
+
+			f := BCJ{Arch: fixture.arch, StartOffset: start}
+			r, err := f.NewReader(iotest.HalfReader(bytes.NewReader(input)))
+			assert.Nil(t, err)
+
+			out, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+			assert.Equal(t, out, expected, "%s decoding with start offset %d should match xz-utils", fixture.name, start)
+		}
+	}
+}
+
+func TestBCJProperties(t *testing.T) {
+	f := BCJ{Arch: BCJARM64, StartOffset: 0x12345678}
+	props := f.EncodeProperties()
+	assert.Equal(t, props, []byte{0x78, 0x56, 0x34, 0x12}, "start offset should be encoded little endian")
+
+	var decoded BCJ
+	assert.Nil(t, decoded.DecodeProperties(props))
+	assert.Equal(t, decoded.StartOffset, uint32(0x12345678), "start offset should round trip")
+
+	assert.Nil(t, decoded.DecodeProperties(nil))
+	assert.Equal(t, decoded.StartOffset, uint32(0), "empty properties mean a start offset of 0")
+	assert.Nil(t, (&BCJ{}).EncodeProperties(), "a start offset of 0 should be encoded as empty properties")
+
+	assert.Equal(t, decoded.DecodeProperties([]byte{0x1, 0x2}), errInvalidBCJProperties)
+}
+
+func TestBCJUnknownArch(t *testing.T) {
+	f := BCJ{Arch: BCJArch(0x42)}
+	_, err := f.NewReader(bytes.NewReader(nil))
+	assert.Equal(t, err, errUnknownBCJArch)
+}
@@ -0,0 +1,112 @@
+package filters
+
+import (
+	"encoding/binary"
+)
+
+// The branch converters below follow the reference implementation in
+// xz-utils (src/liblzma/simple/arm.c, armthumb.c and arm64.c).
+
+type armCoder struct{}
+
+// code converts the 24 bit offset of BL instructions, which are 4 byte
+// aligned and relative to the instruction address plus 8.
+func (armCoder) code(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+	for ; i+4 <= len(buf); i += 4 {
+		if buf[i+3] != 0xEB {
+			continue
+		}
+		src := uint32(buf[i+2])<<16 | uint32(buf[i+1])<<8 | uint32(buf[i])
+		src <<= 2
+
+		var dest uint32
+		if encoding {
+			dest = pos + uint32(i) + 8 + src
+		} else {
+			dest = src - (pos + uint32(i) + 8)
+		}
+		dest >>= 2
+
+		buf[i+2] = byte(dest >> 16)
+		buf[i+1] = byte(dest >> 8)
+		buf[i] = byte(dest)
+	}
+	return i
+}
+
+type armThumbCoder struct{}
+
+// code converts Thumb BL instructions, a pair of 16 bit halves carrying a 22
+// bit offset relative to the instruction address plus 4.
+func (armThumbCoder) code(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+	for ; i+4 <= len(buf); i += 2 {
+		if buf[i+1]&0xF8 != 0xF0 || buf[i+3]&0xF8 != 0xF8 {
+			continue
+		}
+		src := (uint32(buf[i+1])&7)<<19 |
+			uint32(buf[i])<<11 |
+			(uint32(buf[i+3])&7)<<8 |
+			uint32(buf[i+2])
+		src <<= 1
+
+		var dest uint32
+		if encoding {
+			dest = pos + uint32(i) + 4 + src
+		} else {
+			dest = src - (pos + uint32(i) + 4)
+		}
+		dest >>= 1
+
+		buf[i+1] = 0xF0 | byte((dest>>19)&0x7)
+		buf[i] = byte(dest >> 11)
+		buf[i+3] = 0xF8 | byte((dest>>8)&0x7)
+		buf[i+2] = byte(dest)
+		i += 2
+	}
+	return i
+}
+
+type arm64Coder struct{}
+
+// code converts BL instructions and ADRP instructions whose page offset is
+// within +/-512 MiB; ADRP beyond that range is left alone since converting it
+// would rarely help compression.
+func (arm64Coder) code(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+	for ; i+4 <= len(buf); i += 4 {
+		pc := pos + uint32(i)
+		instr := binary.LittleEndian.Uint32(buf[i:])
+
+		if instr>>26 == 0x25 {
+			// BL
+			src := instr
+			pc >>= 2
+			if !encoding {
+				pc = -pc
+			}
+			instr = 0x94000000 | ((src + pc) & 0x03FFFFFF)
+			binary.LittleEndian.PutUint32(buf[i:], instr)
+		} else if instr&0x9F000000 == 0x90000000 {
+			// ADRP
+			src := (instr>>29)&3 | (instr>>3)&0x001FFFFC
+			if (src+0x00020000)&0x001C0000 != 0 {
+				continue
+			}
+
+			pc >>= 12
+			if !encoding {
+				pc = -pc
+			}
+			dest := src + pc
+
+			instr &= 0x9000001F
+			instr |= (dest & 3) << 29
+			instr |= (dest & 0x0003FFFC) << 3
+			instr |= (-(dest & 0x00020000)) & 0x00E00000
+			binary.LittleEndian.PutUint32(buf[i:], instr)
+		}
+	}
+	return i
+}
@@ -0,0 +1,66 @@
+package filters
+
+// The IA-64 converter follows the reference implementation in xz-utils
+// (src/liblzma/simple/ia64.c).
+
+// ia64BranchTable maps a bundle's template to a mask of the slots that may
+// hold a branch.
+var ia64BranchTable = [32]uint32{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	4, 4, 6, 6, 0, 0, 7, 7,
+	4, 4, 0, 0, 4, 4, 0, 0,
+}
+
+type ia64Coder struct{}
+
+// code works on 16 byte bundles of three 41 bit instruction slots, converting
+// the 21 bit bundle offset of IP-relative branches.
+func (ia64Coder) code(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+	for ; i+16 <= len(buf); i += 16 {
+		mask := ia64BranchTable[buf[i]&0x1F]
+		bitPos := uint32(5)
+		for slot := uint32(0); slot < 3; slot, bitPos = slot+1, bitPos+41 {
+			if (mask>>slot)&1 == 0 {
+				continue
+			}
+
+			bytePos := int(bitPos >> 3)
+			bitRes := bitPos & 0x7
+			var instruction uint64
+			for j := 0; j < 6; j++ {
+				instruction |= uint64(buf[i+j+bytePos]) << (8 * uint(j))
+			}
+
+			instNorm := instruction >> bitRes
+			if (instNorm>>37)&0xF != 0x5 || (instNorm>>9)&0x7 != 0 {
+				continue
+			}
+
+			src := uint32((instNorm >> 13) & 0xFFFFF)
+			src |= uint32((instNorm>>36)&1) << 20
+			src <<= 4
+
+			var dest uint32
+			if encoding {
+				dest = pos + uint32(i) + src
+			} else {
+				dest = src - (pos + uint32(i))
+			}
+			dest >>= 4
+
+			instNorm &^= uint64(0x8FFFFF) << 13
+			instNorm |= uint64(dest&0xFFFFF) << 13
+			instNorm |= uint64(dest&0x100000) << (36 - 20)
+
+			instruction &= 1<<bitRes - 1
+			instruction |= instNorm << bitRes
+
+			for j := 0; j < 6; j++ {
+				buf[i+j+bytePos] = byte(instruction >> (8 * uint(j)))
+			}
+		}
+	}
+	return i
+}
@@ -0,0 +1,34 @@
+package filters
+
+// The PowerPC converter follows the reference implementation in xz-utils
+// (src/liblzma/simple/powerpc.c). Only big endian code is supported.
+
+type powerPCCoder struct{}
+
+// code converts relative branch-and-link instructions, opcode 18 with the
+// AA bit clear and the LK bit set, carrying a 24 bit word offset.
+func (powerPCCoder) code(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+	for ; i+4 <= len(buf); i += 4 {
+		if buf[i]>>2 != 0x12 || buf[i+3]&3 != 1 {
+			continue
+		}
+		src := (uint32(buf[i])&3)<<24 |
+			uint32(buf[i+1])<<16 |
+			uint32(buf[i+2])<<8 |
+			uint32(buf[i+3])&^3
+
+		var dest uint32
+		if encoding {
+			dest = pos + uint32(i) + src
+		} else {
+			dest = src - (pos + uint32(i))
+		}
+
+		buf[i] = 0x48 | byte((dest>>24)&0x03)
+		buf[i+1] = byte(dest >> 16)
+		buf[i+2] = byte(dest >> 8)
+		buf[i+3] = buf[i+3]&0x03 | byte(dest)
+	}
+	return i
+}
@@ -0,0 +1,176 @@
+package filters
+
+import (
+	"encoding/binary"
+)
+
+// The RISC-V converter follows the reference implementation in xz-utils
+// (src/liblzma/simple/riscv.c). Unlike the other converters encoding and
+// decoding are not symmetric, so each direction has its own function.
+
+type riscvCoder struct{}
+
+// riscvNotAUIPCPair reports whether inst2 does not use the rd of auipc as its
+// rs1, or is not a 32 bit instruction.
+func riscvNotAUIPCPair(auipc, inst2 uint32) bool {
+	return ((auipc<<8)^(inst2-3))&0xF8003 != 0
+}
+
+// riscvNotSpecialAUIPC reports whether an AUIPC with rd x0 or x2 does not look
+// like the encoded form of an AUIPC pair, in which case it is left alone.
+func riscvNotSpecialAUIPC(auipc, inst2 uint32) bool {
+	return (auipc-0x3117)<<18 >= inst2&0x1D
+}
+
+func (riscvCoder) code(buf []byte, pos uint32, encoding bool) int {
+	if encoding {
+		return riscvEncode(buf, pos)
+	}
+	return riscvDecode(buf, pos)
+}
+
+// riscvEncode converts JAL with rd x1 or x5, storing the absolute target in
+// big endian, and AUIPC paired with a following instruction that uses its rd,
+// storing the combined absolute address in the place of the second
+// instruction. An AUIPC that already looks like the encoded form is swapped
+// around so the decoder does not mistake it for one.
+func riscvEncode(buf []byte, pos uint32) int {
+	if len(buf) < 8 {
+		return 0
+	}
+	limit := len(buf) - 8
+
+	i := 0
+	for ; i <= limit; i += 2 {
+		inst := uint32(buf[i])
+
+		if inst == 0xEF {
+			// JAL
+			b1 := uint32(buf[i+1])
+			if b1&0x0D != 0 {
+				continue
+			}
+			b2 := uint32(buf[i+2])
+			b3 := uint32(buf[i+3])
+
+			addr := (b1&0xF0)<<8 |
+				(b2&0x0F)<<16 |
+				(b2&0x10)<<7 |
+				(b2&0xE0)>>4 |
+				(b3&0x7F)<<4 |
+				(b3&0x80)<<13
+			addr += pos + uint32(i)
+
+			buf[i+1] = byte(b1&0x0F | (addr>>13)&0xF0)
+			buf[i+2] = byte(addr >> 9)
+			buf[i+3] = byte(addr >> 1)
+			i += 4 - 2
+		} else if inst&0x7F == 0x17 {
+			// AUIPC
+			inst = binary.LittleEndian.Uint32(buf[i:])
+
+			if inst&0xE80 != 0 {
+				// rd is neither x0 nor x2
+				inst2 := binary.LittleEndian.Uint32(buf[i+4:])
+				if riscvNotAUIPCPair(inst, inst2) {
+					// Skip far enough that the second
+					// instruction, which may be another
+					// AUIPC, can't be converted and make
+					// this look like a pair to the decoder.
+					i += 6 - 2
+					continue
+				}
+
+				addr := inst & 0xFFFFF000
+				addr += (inst2 >> 20) - ((inst2 >> 19) & 0x1000)
+				addr += pos + uint32(i)
+
+				inst = 0x17 | 2<<7 | inst2<<12
+				binary.LittleEndian.PutUint32(buf[i:], inst)
+				binary.BigEndian.PutUint32(buf[i+4:], addr)
+			} else {
+				fakeRS1 := inst >> 27
+				if riscvNotSpecialAUIPC(inst, fakeRS1) {
+					i += 4 - 2
+					continue
+				}
+
+				fakeAddr := binary.LittleEndian.Uint32(buf[i+4:])
+				fakeInst2 := inst>>12 | fakeAddr<<20
+				inst = 0x17 | fakeRS1<<7 | fakeAddr&0xFFFFF000
+
+				binary.LittleEndian.PutUint32(buf[i:], inst)
+				binary.LittleEndian.PutUint32(buf[i+4:], fakeInst2)
+			}
+			i += 8 - 2
+		}
+	}
+	return i
+}
+
+func riscvDecode(buf []byte, pos uint32) int {
+	if len(buf) < 8 {
+		return 0
+	}
+	limit := len(buf) - 8
+
+	i := 0
+	for ; i <= limit; i += 2 {
+		inst := uint32(buf[i])
+
+		if inst == 0xEF {
+			// JAL
+			b1 := uint32(buf[i+1])
+			if b1&0x0D != 0 {
+				continue
+			}
+			b2 := uint32(buf[i+2])
+			b3 := uint32(buf[i+3])
+
+			addr := (b1&0xF0)<<13 | b2<<9 | b3<<1
+			addr -= pos + uint32(i)
+
+			buf[i+1] = byte(b1&0x0F | (addr>>8)&0xF0)
+			buf[i+2] = byte((addr>>16)&0x0F | (addr>>7)&0x10 | (addr<<4)&0xE0)
+			buf[i+3] = byte((addr>>4)&0x7F | (addr>>13)&0x80)
+			i += 4 - 2
+		} else if inst&0x7F == 0x17 {
+			// AUIPC
+			var inst2 uint32
+			inst = binary.LittleEndian.Uint32(buf[i:])
+
+			if inst&0xE80 != 0 {
+				// rd is neither x0 nor x2, so this was
+				// swapped around by the encoder.
+				inst2 = binary.LittleEndian.Uint32(buf[i+4:])
+				if riscvNotAUIPCPair(inst, inst2) {
+					i += 6 - 2
+					continue
+				}
+
+				addr := inst & 0xFFFFF000
+				addr += inst2 >> 20
+
+				inst = 0x17 | 2<<7 | inst2<<12
+				inst2 = addr
+			} else {
+				inst2RS1 := inst >> 27
+				if riscvNotSpecialAUIPC(inst, inst2RS1) {
+					i += 4 - 2
+					continue
+				}
+
+				addr := binary.BigEndian.Uint32(buf[i+4:])
+				addr -= pos + uint32(i)
+
+				inst2 = inst>>12 | addr<<20
+				inst = 0x17 | inst2RS1<<7 | (addr+0x800)&0xFFFFF000
+			}
+
+			binary.LittleEndian.PutUint32(buf[i:], inst)
+			binary.LittleEndian.PutUint32(buf[i+4:], inst2)
+			i += 8 - 2
+		}
+	}
+	return i
+}
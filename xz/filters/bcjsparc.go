@@ -0,0 +1,38 @@
+package filters
+
+import (
+	"encoding/binary"
+)
+
+// The SPARC converter follows the reference implementation in xz-utils
+// (src/liblzma/simple/sparc.c).
+
+type sparcCoder struct{}
+
+// code converts CALL instructions whose 30 bit displacement fits in 23 bits,
+// which is what the top bits being all zeros or all ones checks for.
+func (sparcCoder) code(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+	for ; i+4 <= len(buf); i += 4 {
+		if !(buf[i] == 0x40 && buf[i+1]&0xC0 == 0x00) &&
+			!(buf[i] == 0x7F && buf[i+1]&0xC0 == 0xC0) {
+			continue
+		}
+		src := binary.BigEndian.Uint32(buf[i:])
+		src <<= 2
+
+		var dest uint32
+		if encoding {
+			dest = pos + uint32(i) + src
+		} else {
+			dest = src - (pos + uint32(i))
+		}
+		dest >>= 2
+
+		dest = ((-((dest >> 22) & 1))<<22)&0x3FFFFFFF |
+			dest&0x3FFFFF |
+			0x40000000
+		binary.BigEndian.PutUint32(buf[i:], dest)
+	}
+	return i
+}
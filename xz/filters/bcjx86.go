@@ -0,0 +1,98 @@
+package filters
+
+// The x86 converter follows the reference implementation in xz-utils
+// (src/liblzma/simple/x86.c).
+
+var x86MaskToBitNumber = [5]uint32{0, 1, 2, 2, 3}
+
+// x86Coder converts the 32 bit displacement of CALL (E8) and JMP (E9)
+// instructions. Since x86 instructions are not aligned, an E8 or E9 byte may
+// just be part of another instruction; prevMask tracks recently seen
+// candidates to avoid converting those.
+type x86Coder struct {
+	prevMask uint32
+	prevPos  uint32
+}
+
+func newX86Coder() *x86Coder {
+	return &x86Coder{prevPos: ^uint32(4)} // -5
+}
+
+func x86TestMSByte(b byte) bool {
+	return (b+1)&0xFE == 0
+}
+
+func (c *x86Coder) code(buf []byte, pos uint32, encoding bool) int {
+	if len(buf) < 5 {
+		return 0
+	}
+
+	prevMask := c.prevMask
+	prevPos := c.prevPos
+	if pos-prevPos > 5 {
+		prevPos = pos - 5
+	}
+
+	limit := len(buf) - 5
+	i := 0
+	for i <= limit {
+		b := buf[i]
+		if b != 0xE8 && b != 0xE9 {
+			i++
+			continue
+		}
+
+		offset := pos + uint32(i) - prevPos
+		prevPos = pos + uint32(i)
+
+		if offset > 5 {
+			prevMask = 0
+		} else {
+			for j := uint32(0); j < offset; j++ {
+				prevMask &= 0x77
+				prevMask <<= 1
+			}
+		}
+
+		b = buf[i+4]
+		if !x86TestMSByte(b) || prevMask>>1 > 4 || prevMask>>1 == 3 {
+			i++
+			prevMask |= 1
+			if x86TestMSByte(b) {
+				prevMask |= 0x10
+			}
+			continue
+		}
+
+		src := uint32(b)<<24 | uint32(buf[i+3])<<16 | uint32(buf[i+2])<<8 | uint32(buf[i+1])
+		var dest uint32
+		for {
+			if encoding {
+				dest = src + (pos + uint32(i) + 5)
+			} else {
+				dest = src - (pos + uint32(i) + 5)
+			}
+			if prevMask == 0 {
+				break
+			}
+
+			bit := x86MaskToBitNumber[prevMask>>1]
+			b = byte(dest >> (24 - bit*8))
+			if !x86TestMSByte(b) {
+				break
+			}
+			src = dest ^ (1<<(32-bit*8) - 1)
+		}
+
+		buf[i+4] = ^byte((dest>>24)&1 - 1)
+		buf[i+3] = byte(dest >> 16)
+		buf[i+2] = byte(dest >> 8)
+		buf[i+1] = byte(dest)
+		i += 5
+		prevMask = 0
+	}
+
+	c.prevMask = prevMask
+	c.prevPos = prevPos
+	return i
+}
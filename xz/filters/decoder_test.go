@@ -0,0 +1,102 @@
+package filters
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+// pushAll writes compressed to dec in pieces of size bytes, reading what has
+// been decoded after each write.
+func pushAll(dec *xz.Decoder, compressed []byte, size int) ([]byte, error) {
+	var out bytes.Buffer
+	buf := make([]byte, 1000)
+	drain := func() error {
+		for {
+			n, err := dec.Read(buf)
+			out.Write(buf[:n])
+			if err == xz.ErrNeedInput || err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for len(compressed) > 0 {
+		n := size
+		if n > len(compressed) {
+			n = len(compressed)
+		}
+		_, err := dec.Write(compressed[:n])
+		if err != nil {
+			return out.Bytes(), err
+		}
+		compressed = compressed[n:]
+		if err := drain(); err != nil {
+			return out.Bytes(), err
+		}
+	}
+	if err := dec.Close(); err != nil {
+		return out.Bytes(), err
+	}
+	return out.Bytes(), drain()
+}
+
+func TestDecoderPieces(t *testing.T) {
+	for _, fixture := range xzFixtures {
+		compressed := readFixture(t, fixture.compressed)
+		expected := readFixture(t, fixture.original)
+		// single bytes split every header, integer and chunk
+		for _, size := range []int{1, 7, 4093, len(compressed)} {
+			actual, err := pushAll(xz.NewDecoder(nil), compressed, size)
+			assert.Nil(t, err, "%s in pieces of %d", fixture.compressed, size)
+			assert.Equal(t, actual, expected, "%s in pieces of %d", fixture.compressed, size)
+		}
+	}
+}
+
+func TestDecoderOutput(t *testing.T) {
+	compressed := readFixture(t, "test2.txt.multistream.xz")
+	var actual bytes.Buffer
+	dec := xz.NewDecoder(func(p []byte) error {
+		actual.Write(p)
+		return nil
+	})
+	_, err := pushAll(dec, compressed, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, actual.Bytes(), readFixture(t, "test2.txt"), "the output function should get all the data")
+
+	dec = xz.NewDecoder(func(p []byte) error {
+		return io.ErrShortWrite
+	})
+	_, err = dec.Write(compressed)
+	assert.Equal(t, err, io.ErrShortWrite, "errors of the output function should be returned")
+}
+
+func TestDecoderErrors(t *testing.T) {
+	compressed := readFixture(t, "test1.txt.xz")
+
+	_, err := pushAll(xz.NewDecoder(nil), compressed[:len(compressed)-1], 13)
+	assert.Equal(t, err, io.ErrUnexpectedEOF, "truncated input should fail on Close")
+
+	padded := append(append([]byte{}, compressed...), 0, 0)
+	_, err = pushAll(xz.NewDecoder(nil), padded, 13)
+	assert.NotNil(t, err, "Stream Padding should be a multiple of four bytes")
+
+	corrupt := append([]byte{}, compressed...)
+	corrupt[len(corrupt)/2] ^= 0x55
+	_, err = pushAll(xz.NewDecoder(nil), corrupt, 13)
+	assert.NotNil(t, err, "corrupt data should be detected")
+
+	dec := xz.NewDecoder(nil)
+	_, err = dec.Write(compressed)
+	assert.Nil(t, err)
+	assert.Nil(t, dec.Close())
+	_, err = dec.Write(compressed)
+	assert.NotNil(t, err, "writing after Close should fail")
+}
@@ -0,0 +1,118 @@
+package filters
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+var errInvalidDeltaProperties = errors.New("Delta filter properties must be a single byte")
+var errDeltaDistance = errors.New("Delta distance must be between 1 and 256")
+
+const (
+	deltaMaxDistance = 256
+	deltaBufferSize  = 16 * xz.KiloByte
+)
+
+// Delta is the delta filter, which stores every byte as the difference from
+// the byte Distance bytes before it. It helps LZMA2 with data such as
+// uncompressed audio or images made of fixed size samples.
+type Delta struct {
+	Distance int
+}
+
+func (f *Delta) ID() xz.MultiByteInteger {
+	return xz.FilterDelta
+}
+
+func (f *Delta) EncodeProperties() []byte {
+	return []byte{byte(f.Distance - 1)}
+}
+
+func (f *Delta) DecodeProperties(props []byte) error {
+	if len(props) != 1 {
+		return errInvalidDeltaProperties
+	}
+	f.Distance = int(props[0]) + 1
+	return nil
+}
+
+// NewReader returns a reader that decodes the delta encoded data read from r.
+func (f *Delta) NewReader(r io.Reader) (io.Reader, error) {
+	if f.Distance < 1 || f.Distance > deltaMaxDistance {
+		return nil, errDeltaDistance
+	}
+	return &deltaReader{r: r, coder: deltaCoder{dist: byte(f.Distance)}}, nil
+}
+
+// NewWriter returns a writer that delta encodes everything written to it
+// before passing it on to w. Closing the writer closes w.
+func (f *Delta) NewWriter(w io.WriteCloser) (io.WriteCloser, error) {
+	if f.Distance < 1 || f.Distance > deltaMaxDistance {
+		return nil, errDeltaDistance
+	}
+	return &deltaWriter{w: w, coder: deltaCoder{dist: byte(f.Distance)}}, nil
+}
+
+// deltaCoder keeps the last 256 bytes of the original data. A distance of
+// 256 is stored as 0, which wraps around to the same slot of history.
+type deltaCoder struct {
+	dist    byte
+	pos     byte
+	history [deltaMaxDistance]byte
+}
+
+func (d *deltaCoder) encode(dst, src []byte) {
+	for i, b := range src {
+		dst[i] = b - d.history[d.pos-d.dist]
+		d.history[d.pos] = b
+		d.pos++
+	}
+}
+
+func (d *deltaCoder) decode(buf []byte) {
+	for i, b := range buf {
+		buf[i] = b + d.history[d.pos-d.dist]
+		d.history[d.pos] = buf[i]
+		d.pos++
+	}
+}
+
+type deltaReader struct {
+	r     io.Reader
+	coder deltaCoder
+}
+
+func (dr *deltaReader) Read(p []byte) (int, error) {
+	n, err := dr.r.Read(p)
+	dr.coder.decode(p[:n])
+	return n, err
+}
+
+type deltaWriter struct {
+	w     io.WriteCloser
+	coder deltaCoder
+	buf   [deltaBufferSize]byte
+}
+
+func (dw *deltaWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > len(dw.buf) {
+			n = len(dw.buf)
+		}
+		dw.coder.encode(dw.buf[:n], p[:n])
+		if _, err := dw.w.Write(dw.buf[:n]); err != nil {
+			return written, err
+		}
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (dw *deltaWriter) Close() error {
+	return dw.w.Close()
+}
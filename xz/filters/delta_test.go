@@ -0,0 +1,47 @@
+package filters
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	input := make([]byte, 3*deltaBufferSize+5)
+	for i := range input {
+		input[i] = byte(i * i / 7)
+	}
+
+	for _, dist := range []int{1, 2, 4, 255, 256} {
+		f := &Delta{Distance: dist}
+		var encoded bytes.Buffer
+		w, err := f.NewWriter(nopWriteCloser{&encoded})
+		assert.Nil(t, err)
+		_, err = w.Write(input)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+		assert.Equal(t, encoded.Bytes()[:dist], input[:dist], "the first bytes have nothing to subtract")
+
+		r, err := f.NewReader(&encoded)
+		assert.Nil(t, err)
+		decoded, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, decoded, input, "distance %d should round trip", dist)
+	}
+}
+
+func TestDeltaProperties(t *testing.T) {
+	f := &Delta{Distance: 256}
+	props := f.EncodeProperties()
+	assert.Equal(t, props, []byte{0xFF})
+
+	var decoded Delta
+	assert.Nil(t, decoded.DecodeProperties(props))
+	assert.Equal(t, decoded, *f)
+	assert.Equal(t, decoded.DecodeProperties(nil), errInvalidDeltaProperties)
+
+	_, err := (&Delta{Distance: 0}).NewWriter(nil)
+	assert.Equal(t, err, errDeltaDistance)
+}
@@ -0,0 +1,75 @@
+package filters
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+// Describe formats a filter the way xz lists it, which is also the option
+// that selects it, for example "--lzma2=dict=8MiB".
+func Describe(f xz.Filter) string {
+	switch f := f.(type) {
+	case *LZMA2:
+		size, err := f.DictSize.size()
+		if err != nil {
+			return "--lzma2=dict=invalid"
+		}
+		return "--lzma2=dict=" + FormatSize(uint64(size))
+	case *Delta:
+		return fmt.Sprintf("--delta=dist=%d", f.Distance)
+	case *BCJ:
+		for name, arch := range bcjNames {
+			if arch != f.Arch {
+				continue
+			}
+			if f.StartOffset != 0 {
+				return fmt.Sprintf("--%s=start=%d", name, f.StartOffset)
+			}
+			return "--" + name
+		}
+	}
+	return fmt.Sprintf("--filter=0x%x", uint64(f.ID()))
+}
+
+// DescribeChain formats a filter chain the way xz lists it.
+func DescribeChain(chain xz.FilterChain) string {
+	s := ""
+	for i, f := range chain {
+		if i > 0 {
+			s += " "
+		}
+		s += Describe(f)
+	}
+	return s
+}
+
+// FormatSize formats a size in the largest unit that holds it exactly, as
+// xz does for dictionary sizes.
+func FormatSize(size uint64) string {
+	switch {
+	case size != 0 && size%xz.MegaByte == 0:
+		return fmt.Sprintf("%dMiB", size/xz.MegaByte)
+	case size != 0 && size%xz.KiloByte == 0:
+		return fmt.Sprintf("%dKiB", size/xz.KiloByte)
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// DecoderMemory estimates the memory the filter chain needs for decoding.
+func DecoderMemory(chain xz.FilterChain) uint64 {
+	var total uint64
+	for _, f := range chain {
+		switch f := f.(type) {
+		case *LZMA2:
+			size, _ := f.DictSize.size()
+			total += uint64(size) + lzma2MaxCompressedChunk + uint64(unsafe.Sizeof(lzmaDecoder{}))
+		case *Delta:
+			total += deltaBufferSize + deltaMaxDistance
+		case *BCJ:
+			total += bcjBufferSize
+		}
+	}
+	return total
+}
@@ -0,0 +1,292 @@
+package filters
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+// autoFiltersMinShare is the part of a Block that has to be machine code for
+// one architecture before its BCJ filter is used, BCJ filters make other
+// data slightly harder to compress.
+const autoFiltersMinShare = 4
+
+// executable is a program found in the data, start is relative to the
+// current Block and may be negative if it began in an earlier Block.
+type executable struct {
+	arch       BCJArch
+	start, end int64
+}
+
+// AutoFilters picks the filter chain of each Block, putting the BCJ filter
+// for the architecture of any ELF, Mach-O or PE executables in the Block in
+// front of the base chain. Executables are found by their headers, which
+// only tell where they begin, so Blocks must be given to Select in order for
+// programs that span several Blocks to be recognised.
+type AutoFilters struct {
+	base    xz.FilterChain
+	carried []executable
+}
+
+// NewAutoFilters creates an AutoFilters that adds to base. Chains that
+// already have a BCJ filter or no room for another filter are left alone.
+func NewAutoFilters(base xz.FilterChain) *AutoFilters {
+	return &AutoFilters{base: base}
+}
+
+// Select returns the filter chain for the next Block.
+func (a *AutoFilters) Select(block []byte) xz.FilterChain {
+	found := append([]executable(nil), a.carried...)
+	found = append(found, findExecutables(block)...)
+
+	size := int64(len(block))
+	a.carried = a.carried[:0]
+	covered := make(map[BCJArch]int64)
+	for _, e := range found {
+		if e.end > size {
+			a.carried = append(a.carried, executable{e.arch, e.start - size, e.end - size})
+		}
+		covered[e.arch] += min64(e.end, size) - max64(e.start, 0)
+	}
+
+	if len(a.base) >= 4 || hasBCJ(a.base) {
+		return a.base
+	}
+	var best BCJArch
+	for arch, n := range covered {
+		if n > covered[best] || n == covered[best] && arch < best {
+			best = arch
+		}
+	}
+	if best == 0 || covered[best]*autoFiltersMinShare < size {
+		return a.base
+	}
+	return append(xz.FilterChain{&BCJ{Arch: best}}, a.base...)
+}
+
+func hasBCJ(chain xz.FilterChain) bool {
+	for _, f := range chain {
+		if _, ok := f.(*BCJ); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	elfMagic    = []byte{0x7F, 'E', 'L', 'F'}
+	peMagic     = []byte{'M', 'Z'}
+	machoMagics = [][]byte{
+		{0xFE, 0xED, 0xFA, 0xCE}, {0xCE, 0xFA, 0xED, 0xFE},
+		{0xFE, 0xED, 0xFA, 0xCF}, {0xCF, 0xFA, 0xED, 0xFE},
+	}
+)
+
+// findExecutables scans data for executable headers.
+func findExecutables(data []byte) []executable {
+	var found []executable
+	scan := func(magic []byte, parse func([]byte) (BCJArch, int64, bool)) {
+		for off := 0; ; off++ {
+			i := bytes.Index(data[off:], magic)
+			if i < 0 {
+				return
+			}
+			off += i
+			if arch, size, ok := parse(data[off:]); ok {
+				found = append(found, executable{arch, int64(off), int64(off) + size})
+			}
+		}
+	}
+	scan(elfMagic, parseELF)
+	scan(peMagic, parsePE)
+	for _, magic := range machoMagics {
+		scan(magic, parseMachO)
+	}
+	return found
+}
+
+// executableMaxSize rejects headers that only look valid by chance.
+const executableMaxSize = 1 << 40
+
+var elfMachines = map[uint16]BCJArch{
+	2:   BCJSPARC,
+	3:   BCJX86,
+	20:  BCJPowerPC,
+	21:  BCJPowerPC,
+	40:  BCJARM,
+	43:  BCJSPARC,
+	50:  BCJIA64,
+	62:  BCJX86,
+	183: BCJARM64,
+	243: BCJRISCV,
+}
+
+// parseELF works out the size of an ELF file from its section and program
+// header tables, which are usually at its end and start.
+func parseELF(b []byte) (BCJArch, int64, bool) {
+	if len(b) < 64 {
+		return 0, 0, false
+	}
+	var order binary.ByteOrder
+	switch b[5] {
+	case 1:
+		order = binary.LittleEndian
+	case 2:
+		order = binary.BigEndian
+	default:
+		return 0, 0, false
+	}
+
+	arch, ok := elfMachines[order.Uint16(b[18:])]
+	if !ok || arch == BCJPowerPC && b[5] != 2 {
+		return 0, 0, false
+	}
+
+	var phoff, shoff uint64
+	var sizes []byte
+	switch b[4] {
+	case 1:
+		phoff = uint64(order.Uint32(b[28:]))
+		shoff = uint64(order.Uint32(b[32:]))
+		sizes = b[42:52]
+	case 2:
+		phoff = order.Uint64(b[32:])
+		shoff = order.Uint64(b[40:])
+		sizes = b[54:64]
+	default:
+		return 0, 0, false
+	}
+	phentsize, phnum := uint64(order.Uint16(sizes)), uint64(order.Uint16(sizes[2:]))
+	shentsize, shnum := uint64(order.Uint16(sizes[4:])), uint64(order.Uint16(sizes[6:]))
+
+	size := phoff + phentsize*phnum
+	if end := shoff + shentsize*shnum; end > size {
+		size = end
+	}
+	if phnum == 0 && shnum == 0 || size > executableMaxSize {
+		return 0, 0, false
+	}
+	return arch, int64(size), true
+}
+
+var peMachines = map[uint16]BCJArch{
+	0x014C: BCJX86,
+	0x8664: BCJX86,
+	0x01C0: BCJARM,
+	0x01C2: BCJARMThumb,
+	0x01C4: BCJARMThumb,
+	0x0200: BCJIA64,
+	0xAA64: BCJARM64,
+	0x5064: BCJRISCV,
+}
+
+// parsePE works out the size of a PE file from its section table.
+func parsePE(b []byte) (BCJArch, int64, bool) {
+	if len(b) < 64 {
+		return 0, 0, false
+	}
+	pe := int(binary.LittleEndian.Uint32(b[0x3C:]))
+	if pe < 64 || pe > len(b)-24 || !bytes.Equal(b[pe:pe+4], []byte{'P', 'E', 0, 0}) {
+		return 0, 0, false
+	}
+	arch, ok := peMachines[binary.LittleEndian.Uint16(b[pe+4:])]
+	if !ok {
+		return 0, 0, false
+	}
+
+	sections := int(binary.LittleEndian.Uint16(b[pe+6:]))
+	table := pe + 24 + int(binary.LittleEndian.Uint16(b[pe+20:]))
+	if sections == 0 || table+40*sections > len(b) {
+		return 0, 0, false
+	}
+	var size int64
+	for i := 0; i < sections; i++ {
+		section := b[table+40*i:]
+		end := int64(binary.LittleEndian.Uint32(section[20:])) + int64(binary.LittleEndian.Uint32(section[16:]))
+		if end > size {
+			size = end
+		}
+	}
+	return arch, size, true
+}
+
+var machoCPUs = map[uint32]BCJArch{
+	0x00000007: BCJX86,
+	0x01000007: BCJX86,
+	0x0000000C: BCJARM,
+	0x0100000C: BCJARM64,
+	0x00000012: BCJPowerPC,
+	0x01000012: BCJPowerPC,
+}
+
+const (
+	machoSegment   = 0x01
+	machoSegment64 = 0x19
+)
+
+// parseMachO works out the size of a Mach-O file from its segments.
+func parseMachO(b []byte) (BCJArch, int64, bool) {
+	if len(b) < 32 {
+		return 0, 0, false
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if b[0] != 0xFE {
+		order = binary.LittleEndian
+	}
+	header := 28
+	if order.Uint32(b) == 0xFEEDFACF {
+		header = 32
+	}
+
+	arch, ok := machoCPUs[order.Uint32(b[4:])]
+	if !ok {
+		return 0, 0, false
+	}
+	ncmds := int(order.Uint32(b[16:]))
+	sizeofcmds := int(order.Uint32(b[20:]))
+	if ncmds == 0 || sizeofcmds < 8*ncmds || sizeofcmds > len(b)-header {
+		return 0, 0, false
+	}
+
+	var size uint64
+	cmds := b[header : header+sizeofcmds]
+	for i := 0; i < ncmds; i++ {
+		if len(cmds) < 8 {
+			return 0, 0, false
+		}
+		cmd, cmdsize := order.Uint32(cmds), int(order.Uint32(cmds[4:]))
+		if cmdsize < 8 || cmdsize > len(cmds) {
+			return 0, 0, false
+		}
+		var end uint64
+		switch {
+		case cmd == machoSegment && cmdsize >= 56:
+			end = uint64(order.Uint32(cmds[32:])) + uint64(order.Uint32(cmds[36:]))
+		case cmd == machoSegment64 && cmdsize >= 72:
+			end = order.Uint64(cmds[40:]) + order.Uint64(cmds[48:])
+		}
+		if end > size {
+			size = end
+		}
+		cmds = cmds[cmdsize:]
+	}
+	if size == 0 || size > executableMaxSize {
+		return 0, 0, false
+	}
+	return arch, int64(size), true
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,89 @@
+package filters
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+// The headers below only fill in the fields findExecutables looks at.
+
+func elfHeader(machine uint16, size uint64) []byte {
+	b := make([]byte, 64)
+	copy(b, elfMagic)
+	b[4], b[5] = 2, 1 // 64 bit, little endian
+	binary.LittleEndian.PutUint16(b[18:], machine)
+	binary.LittleEndian.PutUint64(b[40:], size-64*4) // section headers
+	binary.LittleEndian.PutUint16(b[58:], 64)
+	binary.LittleEndian.PutUint16(b[60:], 4)
+	return b
+}
+
+func peHeader(machine uint16, size uint32) []byte {
+	b := make([]byte, 0x80+24+40)
+	copy(b, peMagic)
+	binary.LittleEndian.PutUint32(b[0x3C:], 0x80)
+	copy(b[0x80:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(b[0x84:], machine)
+	binary.LittleEndian.PutUint16(b[0x86:], 1)
+	binary.LittleEndian.PutUint32(b[0x80+24+16:], size-0x200)
+	binary.LittleEndian.PutUint32(b[0x80+24+20:], 0x200)
+	return b
+}
+
+func machoHeader(cpu uint32, size uint64) []byte {
+	b := make([]byte, 32+72)
+	binary.LittleEndian.PutUint32(b, 0xFEEDFACF)
+	binary.LittleEndian.PutUint32(b[4:], cpu)
+	binary.LittleEndian.PutUint32(b[16:], 1)
+	binary.LittleEndian.PutUint32(b[20:], 72)
+	binary.LittleEndian.PutUint32(b[32:], machoSegment64)
+	binary.LittleEndian.PutUint32(b[36:], 72)
+	binary.LittleEndian.PutUint64(b[32+48:], size)
+	return b
+}
+
+func TestFindExecutables(t *testing.T) {
+	data := make([]byte, 64*xz.KiloByte)
+	copy(data[512:], elfHeader(183, 4096))
+	copy(data[8192:], peHeader(0x8664, 8192))
+	copy(data[20480:], machoHeader(0x0100000C, 1024))
+	copy(data[30000:], "MZ but not a PE file, \x7fELF but not an ELF file")
+
+	found := findExecutables(data)
+	assert.Equal(t, found, []executable{
+		{BCJARM64, 512, 512 + 4096},
+		{BCJX86, 8192, 8192 + 8192},
+		{BCJARM64, 20480, 20480 + 1024},
+	})
+}
+
+func TestAutoFilters(t *testing.T) {
+	lzma2, err := ParseFilterChain("lzma2:preset=0")
+	assert.Nil(t, err)
+	auto := NewAutoFilters(lzma2)
+
+	block := make([]byte, 16*xz.KiloByte)
+	assert.Equal(t, auto.Select(block), lzma2, "data without executables should use the base chain")
+
+	copy(block[1024:], elfHeader(62, 40*xz.KiloByte))
+	assert.Equal(t, auto.Select(block)[0], xz.Filter(&BCJ{Arch: BCJX86}), "the BCJ filter should be prepended")
+
+	// the rest of the executable is in the next two Blocks
+	assert.Equal(t, len(auto.Select(make([]byte, len(block)))), 2)
+	assert.Equal(t, len(auto.Select(make([]byte, len(block)))), 2)
+	assert.Equal(t, auto.Select(make([]byte, len(block))), lzma2, "the executable should have ended")
+
+	small := make([]byte, len(block))
+	copy(small, peHeader(0x8664, 1024))
+	assert.Equal(t, auto.Select(small), lzma2, "a small part of machine code should not add a filter")
+
+	x86, err := ParseFilterChain("x86 lzma2:preset=0")
+	assert.Nil(t, err)
+	arm := make([]byte, len(block))
+	copy(arm, elfHeader(183, uint64(len(arm))))
+	assert.Equal(t, NewAutoFilters(x86).Select(arm), x86, "chains with a BCJ filter should be kept")
+}
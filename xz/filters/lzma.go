@@ -0,0 +1,202 @@
+package filters
+
+import (
+	"errors"
+)
+
+var errInvalidLZMAProperties = errors.New("LZMA properties byte is invalid")
+var errLZMA2LiteralBits = errors.New("LZMA2 requires lc + lp <= 4")
+
+// The constants and probability model below are shared by the LZMA decoder
+// and encoder, they follow the description of LZMA in the LZMA SDK.
+const (
+	lzmaNumStates    = 12
+	lzmaNumLitStates = 7
+	lzmaPosStatesMax = 1 << 4
+
+	lzmaMatchMinLen = 2
+	lzmaMatchMaxLen = 273
+
+	lzmaLenLowBits     = 3
+	lzmaLenMidBits     = 3
+	lzmaLenHighBits    = 8
+	lzmaLenLowSymbols  = 1 << lzmaLenLowBits
+	lzmaLenMidSymbols  = 1 << lzmaLenMidBits
+	lzmaLenHighSymbols = 1 << lzmaLenHighBits
+
+	lzmaLenToPosStates     = 4
+	lzmaPosSlotBits        = 6
+	lzmaStartPosModelIndex = 4
+	lzmaEndPosModelIndex   = 14
+	lzmaNumFullDistances   = 1 << (lzmaEndPosModelIndex >> 1)
+	lzmaAlignBits          = 4
+	lzmaAlignSize          = 1 << lzmaAlignBits
+
+	lzmaLiteralCoderSize = 0x300
+
+	lzmaProbBits = 11
+	lzmaProbInit = 1 << (lzmaProbBits - 1)
+	lzmaMoveBits = 5
+)
+
+// lzmaProb is an adaptive probability of a bit being 0, out of
+// 1 << lzmaProbBits.
+type lzmaProb uint16
+
+// lzmaProperties are the lc, lp and pb parameters of LZMA, stored in a single
+// byte as (pb * 5 + lp) * 9 + lc.
+type lzmaProperties struct {
+	lc uint // literal context bits
+	lp uint // literal position bits
+	pb uint // position bits
+}
+
+func (p *lzmaProperties) decode(b byte) error {
+	if b > (4*5+4)*9+8 {
+		return errInvalidLZMAProperties
+	}
+	p.lc = uint(b % 9)
+	b /= 9
+	p.lp = uint(b % 5)
+	p.pb = uint(b / 5)
+	if p.lc+p.lp > 4 {
+		return errLZMA2LiteralBits
+	}
+	return nil
+}
+
+func (p lzmaProperties) encode() byte {
+	return byte((p.pb*5+p.lp)*9 + p.lc)
+}
+
+// lzmaState is the state of the LZMA state machine, recording the kinds of
+// the last few packets. States below lzmaNumLitStates follow a literal.
+type lzmaState uint32
+
+func (s lzmaState) isLiteral() bool {
+	return s < lzmaNumLitStates
+}
+
+func (s *lzmaState) updateLiteral() {
+	switch {
+	case *s < 4:
+		*s = 0
+	case *s < 10:
+		*s -= 3
+	default:
+		*s -= 6
+	}
+}
+
+func (s *lzmaState) updateMatch() {
+	if s.isLiteral() {
+		*s = 7
+	} else {
+		*s = 10
+	}
+}
+
+func (s *lzmaState) updateRep() {
+	if s.isLiteral() {
+		*s = 8
+	} else {
+		*s = 11
+	}
+}
+
+func (s *lzmaState) updateShortRep() {
+	if s.isLiteral() {
+		*s = 9
+	} else {
+		*s = 11
+	}
+}
+
+// lzmaLenToPosState picks the set of distance slot probabilities used for a
+// match of the given length, short matches tend to have short distances.
+func lzmaLenToPosState(length uint32) uint32 {
+	length -= lzmaMatchMinLen
+	if length < lzmaLenToPosStates-1 {
+		return length
+	}
+	return lzmaLenToPosStates - 1
+}
+
+type lzmaLenProbs struct {
+	choice  lzmaProb
+	choice2 lzmaProb
+	low     [lzmaPosStatesMax][lzmaLenLowSymbols]lzmaProb
+	mid     [lzmaPosStatesMax][lzmaLenMidSymbols]lzmaProb
+	high    [lzmaLenHighSymbols]lzmaProb
+}
+
+// lzmaProbs are all the probabilities of an LZMA coder.
+type lzmaProbs struct {
+	isMatch    [lzmaNumStates][lzmaPosStatesMax]lzmaProb
+	isRep      [lzmaNumStates]lzmaProb
+	isRepG0    [lzmaNumStates]lzmaProb
+	isRepG1    [lzmaNumStates]lzmaProb
+	isRepG2    [lzmaNumStates]lzmaProb
+	isRep0Long [lzmaNumStates][lzmaPosStatesMax]lzmaProb
+
+	posSlot [lzmaLenToPosStates][1 << lzmaPosSlotBits]lzmaProb
+	// posSpecial is indexed from 1 by the reverse bit tree coders, one
+	// more than the LZMA SDK uses so the base offset is never negative.
+	posSpecial [1 + lzmaNumFullDistances - lzmaEndPosModelIndex]lzmaProb
+	align      [lzmaAlignSize]lzmaProb
+
+	len    lzmaLenProbs
+	repLen lzmaLenProbs
+
+	literal []lzmaProb
+}
+
+func resetProbs(probs []lzmaProb) {
+	for i := range probs {
+		probs[i] = lzmaProbInit
+	}
+}
+
+func (l *lzmaLenProbs) reset() {
+	l.choice = lzmaProbInit
+	l.choice2 = lzmaProbInit
+	for i := range l.low {
+		resetProbs(l.low[i][:])
+		resetProbs(l.mid[i][:])
+	}
+	resetProbs(l.high[:])
+}
+
+// reset sets every probability back to even, sizing the literal coders for
+// the given properties.
+func (p *lzmaProbs) reset(props lzmaProperties) {
+	for i := range p.isMatch {
+		resetProbs(p.isMatch[i][:])
+		resetProbs(p.isRep0Long[i][:])
+	}
+	resetProbs(p.isRep[:])
+	resetProbs(p.isRepG0[:])
+	resetProbs(p.isRepG1[:])
+	resetProbs(p.isRepG2[:])
+	for i := range p.posSlot {
+		resetProbs(p.posSlot[i][:])
+	}
+	resetProbs(p.posSpecial[:])
+	resetProbs(p.align[:])
+	p.len.reset()
+	p.repLen.reset()
+
+	size := lzmaLiteralCoderSize << (props.lc + props.lp)
+	if cap(p.literal) < size {
+		p.literal = make([]lzmaProb, size)
+	}
+	p.literal = p.literal[:size]
+	resetProbs(p.literal)
+}
+
+// literalProbs returns the literal coder for the byte at pos following
+// prevByte.
+func (p *lzmaProbs) literalProbs(props lzmaProperties, pos uint32, prevByte byte) []lzmaProb {
+	litState := (pos&(1<<props.lp-1))<<props.lc + uint32(prevByte)>>(8-props.lc)
+	return p.literal[lzmaLiteralCoderSize*litState : lzmaLiteralCoderSize*(litState+1)]
+}
@@ -1,19 +1,46 @@
 package filters
 
 import (
+	"bufio"
 	"errors"
-	"github.com/ZymoticB/goxz/xz"
+	"io"
 	"math"
+
+	"github.com/ZymoticB/goxz/xz"
 )
 
 var errInvalidLZMADictSize = errors.New("LZMA2 header contains invalid dictionary size")
+var errInvalidLZMA2Properties = errors.New("LZMA2 filter properties must be a single byte")
+var errLZMA2Control = errors.New("LZMA2 chunk has an invalid control byte")
+var errLZMA2DictReset = errors.New("LZMA2 data does not start with a dictionary reset")
+var errLZMA2MissingProperties = errors.New("LZMA2 chunk needs new properties after a dictionary reset")
+var errLZMAPreset = errors.New("LZMA2 preset must be between 0 and 9")
+var errLZMADictSizeRange = errors.New("LZMA2 dictionary size must be between 4 KiB and 1536 MiB")
+var errLZMALiteralOptions = errors.New("LZMA2 lc, lp and pb must be between 0 and 4")
+var errLZMANiceLen = errors.New("LZMA2 nice length must be between 2 and 273")
+var errLZMAMode = errors.New("LZMA2 mode must be fast or normal")
+var errLZMADepth = errors.New("LZMA2 depth can not be negative")
+var errLZMA2WriterClosed = errors.New("LZMA2 writer is already closed")
+
+const (
+	lzma2MaxCompressedChunk   = 1 << 16
+	lzma2MaxUncompressedChunk = 1 << 21
+
+	// lzma2MaxSymbolSize bounds how much one packet can add to a chunk.
+	lzma2MaxSymbolSize = 32
+	// lzma2WriteSize is how much input is buffered at a time.
+	lzma2WriteSize = 1 << 20
+
+	lzmaMinDictSize = 4 * xz.KiloByte
+	lzmaMaxDictSize = 1536 * xz.MegaByte
+)
 
 type LZMADictSize int8
 
 func (s LZMADictSize) size() (uint32, error) {
 	size := int8(s)
 	switch {
-	case size > 40:
+	case size > 40 || size < 0:
 		return 0, errInvalidLZMADictSize
 	case size == 40:
 		return (4 * xz.GigaByte) - 1, nil
@@ -28,3 +55,573 @@ func (s LZMADictSize) size() (uint32, error) {
 type LZMA2Header struct {
 	DictSize LZMADictSize
 }
+
+// lzmaDictSizeFor returns the smallest dictionary size the LZMA2 header can
+// store that is at least size.
+func lzmaDictSizeFor(size uint32) LZMADictSize {
+	for s := LZMADictSize(0); s < 40; s++ {
+		if n, _ := s.size(); n >= size {
+			return s
+		}
+	}
+	return 40
+}
+
+// LZMAMode selects how hard the encoder looks for matches.
+type LZMAMode int
+
+const (
+	// LZMAModeFast encodes the longest match found at each position.
+	LZMAModeFast LZMAMode = iota
+	// LZMAModeNormal compares the prices of the ways the data ahead could be
+	// encoded, which is slower but compresses better.
+	LZMAModeNormal
+)
+
+// LZMAOptions are the settings of the LZMA2 encoder, named after the options
+// of xz's --lzma2.
+type LZMAOptions struct {
+	DictSize uint32
+	LC       uint
+	LP       uint
+	PB       uint
+	Mode     LZMAMode
+	NiceLen  int
+	// Depth is how many earlier occurrences of the data are compared when
+	// looking for a match, 0 picks a depth based on NiceLen and Mode.
+	Depth int
+}
+
+var lzmaPresetDictSizes = [...]uint32{
+	256 * xz.KiloByte, 1 * xz.MegaByte, 2 * xz.MegaByte, 4 * xz.MegaByte, 4 * xz.MegaByte,
+	8 * xz.MegaByte, 8 * xz.MegaByte, 16 * xz.MegaByte, 32 * xz.MegaByte, 64 * xz.MegaByte,
+}
+
+// LZMAPreset returns the options of xz's compression presets 0 to 9, with or
+// without the extreme flag.
+func LZMAPreset(level int, extreme bool) (LZMAOptions, error) {
+	if level < 0 || level >= len(lzmaPresetDictSizes) {
+		return LZMAOptions{}, errLZMAPreset
+	}
+
+	opts := LZMAOptions{
+		DictSize: lzmaPresetDictSizes[level],
+		LC:       3,
+		LP:       0,
+		PB:       2,
+	}
+	switch {
+	case level <= 3:
+		opts.Mode = LZMAModeFast
+		opts.NiceLen = 273
+		if level <= 1 {
+			opts.NiceLen = 128
+		}
+		opts.Depth = [...]int{4, 8, 24, 48}[level]
+	case level == 4:
+		opts.Mode = LZMAModeNormal
+		opts.NiceLen = 16
+	case level == 5:
+		opts.Mode = LZMAModeNormal
+		opts.NiceLen = 32
+	default:
+		opts.Mode = LZMAModeNormal
+		opts.NiceLen = 64
+	}
+
+	if extreme {
+		opts.Mode = LZMAModeNormal
+		opts.Depth = 0
+		if level == 3 || level == 5 {
+			opts.NiceLen = 192
+		} else {
+			opts.NiceLen = 273
+			opts.Depth = 512
+		}
+	}
+	return opts, nil
+}
+
+func (o *LZMAOptions) validate() error {
+	switch {
+	case o.DictSize < lzmaMinDictSize || o.DictSize > lzmaMaxDictSize:
+		return errLZMADictSizeRange
+	case o.LC > 4 || o.LP > 4 || o.PB > 4:
+		return errLZMALiteralOptions
+	case o.LC+o.LP > 4:
+		return errLZMA2LiteralBits
+	case o.NiceLen < lzmaMatchMinLen || o.NiceLen > lzmaMatchMaxLen:
+		return errLZMANiceLen
+	case o.Mode != LZMAModeFast && o.Mode != LZMAModeNormal:
+		return errLZMAMode
+	case o.Depth < 0:
+		return errLZMADepth
+	}
+	return nil
+}
+
+func (o *LZMAOptions) depth() int {
+	switch {
+	case o.Depth > 0:
+		return o.Depth
+	case o.Mode == LZMAModeFast:
+		return 4 + o.NiceLen/4
+	}
+	return 16 + o.NiceLen/2
+}
+
+// LZMA2 is the LZMA2 filter, the only filter the xz format allows as the last
+// one in a chain. Its only property is the dictionary size, the rest of the
+// LZMA parameters are stored in the compressed data.
+type LZMA2 struct {
+	LZMA2Header
+
+	// Options are only needed for encoding, use NewLZMA2 to keep them in
+	// line with the header.
+	Options LZMAOptions
+}
+
+// NewLZMA2 creates an LZMA2 filter that encodes with the given options.
+func NewLZMA2(opts LZMAOptions) (*LZMA2, error) {
+	err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &LZMA2{
+		LZMA2Header: LZMA2Header{DictSize: lzmaDictSizeFor(opts.DictSize)},
+		Options:     opts,
+	}, nil
+}
+
+func (f *LZMA2) ID() xz.MultiByteInteger {
+	return xz.FilterLZMA2
+}
+
+func (f *LZMA2) EncodeProperties() []byte {
+	return []byte{byte(f.DictSize)}
+}
+
+func (f *LZMA2) DecodeProperties(props []byte) error {
+	if len(props) != 1 {
+		return errInvalidLZMA2Properties
+	}
+	f.DictSize = LZMADictSize(props[0])
+	_, err := f.DictSize.size()
+	return err
+}
+
+// NewReader returns a reader of the data decoded from the LZMA2 data in r.
+// Unless r implements io.ByteReader the reader may read past the end of the
+// LZMA2 data.
+func (f *LZMA2) NewReader(r io.Reader) (io.Reader, error) {
+	dictSize, err := f.DictSize.size()
+	if err != nil {
+		return nil, err
+	}
+
+	br, ok := r.(lzma2ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	dict := getLZMADict(f.DictSize, dictSize)
+	return &lzma2Reader{
+		br:            br,
+		dictSize:      f.DictSize,
+		dict:          dict,
+		dec:           lzmaDecoder{dict: dict},
+		chunk:         lzma2ChunkPool.Get().(*[lzma2MaxCompressedChunk]byte),
+		needDictReset: true,
+		needProps:     true,
+	}, nil
+}
+
+// NewWriter returns a writer that encodes the data written to it as LZMA2
+// into w using f.Options.
+func (f *LZMA2) NewWriter(w io.WriteCloser) (io.WriteCloser, error) {
+	opts := f.Options
+	err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
+	dictSize, err := f.DictSize.size()
+	if err != nil {
+		return nil, err
+	}
+	if dictSize < opts.DictSize {
+		return nil, errInvalidLZMADictSize
+	}
+
+	win := getLZMAWindow(f.DictSize, opts.DictSize)
+	return &lzma2Writer{
+		w:        w,
+		dictSize: f.DictSize,
+		win:      win,
+		enc: lzmaEncoder{
+			props:      lzmaProperties{lc: opts.LC, lp: opts.LP, pb: opts.PB},
+			win:        win,
+			niceLen:    opts.NiceLen,
+			depth:      opts.depth(),
+			optimal:    opts.Mode == LZMAModeNormal,
+			matchesPos: -1,
+		},
+		needDictReset:  true,
+		needProps:      true,
+		needStateReset: true,
+	}, nil
+}
+
+type lzma2ByteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// lzma2Reader splits LZMA2 data into its chunks. Each chunk either holds
+// uncompressed data or LZMA data with its own range coder, and the control
+// byte starting the chunk says which parts of the decoder state to reset.
+type lzma2Reader struct {
+	br lzma2ByteReader
+	// dictSize is the pool dict goes back to at the end of the data
+	dictSize LZMADictSize
+	dict     *lzmaDict
+	dec      lzmaDecoder
+	rc       rangeDecoder
+	chunk    *[lzma2MaxCompressedChunk]byte
+
+	// uncompressed is how much of the current chunk is left to produce.
+	uncompressed int
+	compressed   bool
+
+	needDictReset bool
+	needProps     bool
+	err           error
+}
+
+func (z *lzma2Reader) Read(p []byte) (int, error) {
+	for {
+		if z.dict != nil && z.dict.pending > 0 {
+			return z.dict.read(p), nil
+		}
+		if z.err != nil {
+			if z.err == io.EOF {
+				z.release()
+			}
+			return 0, z.err
+		}
+
+		switch {
+		case z.uncompressed == 0:
+			z.err = z.nextChunk()
+			if z.err == xz.ErrNeedInput {
+				// the Decoder only passes on whole chunks, so
+				// nothing of the next one has been read yet
+				z.err = nil
+				return 0, xz.ErrNeedInput
+			}
+		case z.compressed:
+			z.err = z.dec.decode(&z.rc, &z.uncompressed)
+			if z.err == nil && z.rc.overrun {
+				z.err = errLZMA2Corrupt
+			}
+			if z.err == nil && z.uncompressed == 0 && !z.rc.finished() {
+				z.err = errLZMA2Corrupt
+			}
+		default:
+			z.err = z.copyUncompressed()
+		}
+	}
+}
+
+// release gives the buffers back to their pools once everything has been
+// read.
+func (z *lzma2Reader) release() {
+	if z.dict == nil {
+		return
+	}
+	putLZMADict(z.dictSize, z.dict)
+	lzma2ChunkPool.Put(z.chunk)
+	z.dict, z.dec.dict, z.chunk = nil, nil, nil
+}
+
+func (z *lzma2Reader) readUint16() (int, error) {
+	var buf [2]byte
+	_, err := io.ReadFull(z.br, buf[:])
+	return int(buf[0])<<8 | int(buf[1]), unexpectedEOF(err)
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF for reads of data
+// the LZMA2 stream says must be there.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (z *lzma2Reader) nextChunk() error {
+	control, err := z.br.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if control == 0x00 {
+		return io.EOF
+	}
+
+	if control >= 0xE0 || control == 0x01 {
+		z.needProps = true
+		z.needDictReset = false
+		z.dict.reset()
+	} else if z.needDictReset {
+		return errLZMA2DictReset
+	}
+
+	if control < 0x80 {
+		if control > 0x02 {
+			return errLZMA2Control
+		}
+		size, err := z.readUint16()
+		if err != nil {
+			return err
+		}
+		z.uncompressed = size + 1
+		z.compressed = false
+		return nil
+	}
+
+	size, err := z.readUint16()
+	if err != nil {
+		return err
+	}
+	z.uncompressed = int(control&0x1F)<<16 + size + 1
+
+	compressedSize, err := z.readUint16()
+	if err != nil {
+		return err
+	}
+	compressedSize++
+
+	switch control >> 5 {
+	case 4: // no reset
+		if z.needProps {
+			return errLZMA2MissingProperties
+		}
+	case 5: // state reset
+		if z.needProps {
+			return errLZMA2MissingProperties
+		}
+		z.dec.reset()
+	default: // state reset with new properties, and maybe a dictionary reset
+		props, err := z.br.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		err = z.dec.props.decode(props)
+		if err != nil {
+			return err
+		}
+		z.needProps = false
+		z.dec.reset()
+	}
+
+	chunk := z.chunk[:compressedSize]
+	_, err = io.ReadFull(z.br, chunk)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if !z.rc.init(chunk) {
+		return errLZMA2Corrupt
+	}
+	z.compressed = true
+	return nil
+}
+
+func (z *lzma2Reader) copyUncompressed() error {
+	n := z.uncompressed
+	if n > z.dict.available() {
+		n = z.dict.available()
+	}
+	if n > len(z.chunk) {
+		n = len(z.chunk)
+	}
+
+	buf := z.chunk[:n]
+	_, err := io.ReadFull(z.br, buf)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	z.dict.write(buf)
+	z.uncompressed -= n
+	return nil
+}
+
+// lzma2Writer encodes LZMA2 chunks. Each chunk is range coded on its own, and
+// is stored uncompressed instead if LZMA did not make it any smaller.
+type lzma2Writer struct {
+	w io.WriteCloser
+	// dictSize is the pool win goes back to once the writer is closed
+	dictSize LZMADictSize
+	win      *lzmaWindow
+	enc      lzmaEncoder
+	rc       rangeEncoder
+
+	chunkStart int64
+	chunkOpen  bool
+
+	needDictReset  bool
+	needProps      bool
+	needStateReset bool
+	err            error
+}
+
+func (z *lzma2Writer) Write(p []byte) (int, error) {
+	n := 0
+	for z.err == nil && n < len(p) {
+		end := n + lzma2WriteSize
+		if end > len(p) {
+			end = len(p)
+		}
+
+		keep := z.enc.pos - z.win.dictSize
+		if z.chunkStart < keep {
+			keep = z.chunkStart
+		}
+		z.win.write(p[n:end], keep)
+		n = end
+		z.err = z.encode(false)
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	return n, nil
+}
+
+// Close encodes the rest of the data, ends the LZMA2 data and closes the
+// underlying writer.
+func (z *lzma2Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	z.err = z.encode(true)
+	if z.err == nil && z.chunkOpen {
+		z.err = z.endChunk()
+	}
+	if z.err == nil {
+		_, z.err = z.w.Write([]byte{0x00})
+	}
+	if z.err == nil {
+		z.err = z.w.Close()
+	}
+	if z.err != nil {
+		return z.err
+	}
+	z.Release()
+	return nil
+}
+
+// Release gives the window back to its pool.
+func (z *lzma2Writer) Release() {
+	if z.win != nil {
+		putLZMAWindow(z.dictSize, z.win)
+		z.win, z.enc.win = nil, nil
+	}
+	z.err = errLZMA2WriterClosed
+}
+
+// encode encodes the buffered input, keeping back enough of it for the
+// longest match unless final is set.
+func (z *lzma2Writer) encode(final bool) error {
+	for {
+		avail := z.win.end() - z.enc.pos
+		if avail == 0 || (!final && avail < z.enc.lookahead()) {
+			return nil
+		}
+
+		if !z.chunkOpen {
+			z.startChunk()
+		}
+		z.enc.pos += int64(z.enc.encodeSymbol(&z.rc))
+
+		if len(z.rc.out)+z.rc.pending() > lzma2MaxCompressedChunk-lzma2MaxSymbolSize ||
+			z.enc.pos-z.chunkStart > lzma2MaxUncompressedChunk-lzmaMatchMaxLen {
+			err := z.endChunk()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (z *lzma2Writer) startChunk() {
+	if z.needStateReset {
+		z.enc.reset()
+	}
+	z.rc.init()
+	z.chunkStart = z.enc.pos
+	z.chunkOpen = true
+}
+
+func (z *lzma2Writer) endChunk() error {
+	z.chunkOpen = false
+	z.rc.flush()
+
+	uncompressed := int(z.enc.pos - z.chunkStart)
+	compressed := len(z.rc.out)
+	if compressed >= uncompressed {
+		return z.writeUncompressed(z.chunkStart, z.enc.pos)
+	}
+
+	var control byte
+	switch {
+	case z.needDictReset:
+		control = 0xE0
+	case z.needProps:
+		control = 0xC0
+	case z.needStateReset:
+		control = 0xA0
+	default:
+		control = 0x80
+	}
+
+	u, c := uncompressed-1, compressed-1
+	header := []byte{control | byte(u>>16), byte(u >> 8), byte(u), byte(c >> 8), byte(c)}
+	if control >= 0xC0 {
+		header = append(header, z.enc.props.encode())
+	}
+	z.needDictReset, z.needProps, z.needStateReset = false, false, false
+
+	_, err := z.w.Write(header)
+	if err != nil {
+		return err
+	}
+	_, err = z.w.Write(z.rc.out)
+	return err
+}
+
+// writeUncompressed stores the data between start and end in uncompressed
+// chunks. The decoder does not see the LZMA state changes made while encoding
+// it, so the next LZMA chunk has to reset the state.
+func (z *lzma2Writer) writeUncompressed(start, end int64) error {
+	for start < end {
+		size := end - start
+		if size > lzma2MaxCompressedChunk {
+			size = lzma2MaxCompressedChunk
+		}
+
+		control := byte(0x02)
+		if z.needDictReset {
+			control = 0x01
+			z.needDictReset = false
+		}
+		_, err := z.w.Write([]byte{control, byte((size - 1) >> 8), byte(size - 1)})
+		if err != nil {
+			return err
+		}
+		_, err = z.w.Write(z.win.buf[start-z.win.start : start-z.win.start+size])
+		if err != nil {
+			return err
+		}
+		start += size
+	}
+	z.needStateReset = true
+	return nil
+}
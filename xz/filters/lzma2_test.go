@@ -0,0 +1,201 @@
+package filters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"runtime"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+/*
+The .xz files in test were made with xz-utils from the files next to them, each
+with different settings: test2.txt.xz uses the defaults, test2.txt.blocks.xz
+has several Blocks, test2.txt.lclppb.xz uses lc=0,lp=2,pb=0 and no check,
+test2.txt.multistream.xz is two Streams with Stream Padding between them and
+random.bin.xz is stored in uncompressed chunks.
+*/
+
+var xzFixtures = []struct {
+	compressed string
+	original   string
+}{
+	{"test1.txt.xz", "test1.txt"},
+	{"test2.txt.xz", "test2.txt"},
+	{"test2.txt.blocks.xz", "test2.txt"},
+	{"test2.txt.lclppb.xz", "test2.txt"},
+	{"test2.txt.multistream.xz", "test2.txt"},
+	{"random.bin.xz", "random.bin"},
+	{"bcj/arm64.bin.xz", "bcj/arm64.bin"},
+}
+
+func readFixture(t testing.TB, name string) []byte {
+	buf, err := ioutil.ReadFile("../../test/" + name)
+	assert.Nil(t, err)
+	return buf
+}
+
+func TestXZDecode(t *testing.T) {
+	for _, fixture := range xzFixtures {
+		compressed := readFixture(t, fixture.compressed)
+		expected := readFixture(t, fixture.original)
+
+		r, err := xz.NewReader(iotest.HalfReader(bytes.NewReader(compressed)))
+		assert.Nil(t, err, fixture.compressed)
+		actual, err := ioutil.ReadAll(r)
+		assert.Nil(t, err, fixture.compressed)
+		assert.Equal(t, actual, expected, "%s should decompress to %s", fixture.compressed, fixture.original)
+	}
+}
+
+func TestXZEncode(t *testing.T) {
+	expected := readFixture(t, "test2.txt")
+	chain, err := ParseFilterChain("delta:dist=2 x86 lzma2:preset=1")
+	assert.Nil(t, err)
+
+	var compressed bytes.Buffer
+	w, err := xz.NewWriter(&compressed, xz.WriterConfig{Filters: chain, BlockSize: 100 * xz.KiloByte})
+	assert.Nil(t, err)
+	_, err = w.Write(expected)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	r, err := xz.NewReader(&compressed)
+	assert.Nil(t, err)
+	actual, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, actual, expected, "encoded data should decode to the input")
+}
+
+func TestXZDecodeTruncated(t *testing.T) {
+	compressed := readFixture(t, "test2.txt.xz")
+	for _, size := range []int{100, len(compressed) / 2, len(compressed) - 1} {
+		r, err := xz.NewReader(bytes.NewReader(compressed[:size]))
+		assert.Nil(t, err)
+		_, err = ioutil.ReadAll(r)
+		assert.NotNil(t, err, "reading %d bytes of the stream should fail", size)
+	}
+}
+
+func TestXZDecodeCorrupt(t *testing.T) {
+	compressed := readFixture(t, "test2.txt.lclppb.xz")
+	// flip a bit in the middle of the LZMA2 data, there is no check to
+	// catch it so the LZMA2 decoder has to
+	compressed[len(compressed)/2] ^= 0x10
+
+	r, err := xz.NewReader(bytes.NewReader(compressed))
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.NotNil(t, err, "corrupt LZMA2 data should not decode")
+}
+
+func TestLZMAProperties(t *testing.T) {
+	var props lzmaProperties
+	assert.Nil(t, props.decode(0x5D))
+	assert.Equal(t, props, lzmaProperties{lc: 3, lp: 0, pb: 2}, "the default properties should decode")
+	assert.Equal(t, props.encode(), byte(0x5D), "properties should encode to the same byte")
+
+	assert.Equal(t, props.decode(225), errInvalidLZMAProperties)
+	assert.Equal(t, props.decode((0*5+1)*9+4), errLZMA2LiteralBits)
+}
+
+func TestLZMA2Properties(t *testing.T) {
+	var f LZMA2
+	assert.Nil(t, f.DecodeProperties([]byte{40}))
+	assert.Equal(t, f.EncodeProperties(), []byte{40}, "properties should round trip")
+	assert.Equal(t, f.DecodeProperties([]byte{41}), errInvalidLZMADictSize)
+	assert.Equal(t, f.DecodeProperties(nil), errInvalidLZMA2Properties)
+}
+
+func lzma2RoundTrip(t *testing.T, opts LZMAOptions, input []byte, writeSize int) []byte {
+	f, err := NewLZMA2(opts)
+	assert.Nil(t, err)
+
+	var compressed bytes.Buffer
+	w, err := f.NewWriter(nopWriteCloser{&compressed})
+	assert.Nil(t, err)
+	for len(input) > 0 {
+		n := writeSize
+		if n > len(input) {
+			n = len(input)
+		}
+		_, err = w.Write(input[:n])
+		assert.Nil(t, err)
+		input = input[n:]
+	}
+	assert.Nil(t, w.Close())
+
+	r, err := f.NewReader(bytes.NewReader(compressed.Bytes()))
+	assert.Nil(t, err)
+	decoded, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	return decoded
+}
+
+func TestLZMA2RoundTrip(t *testing.T) {
+	text := readFixture(t, "test2.txt")
+	random := readFixture(t, "random.bin")
+	inputs := map[string][]byte{
+		"empty":  {},
+		"byte":   {'x'},
+		"zeros":  make([]byte, 3*lzma2MaxUncompressedChunk),
+		"text":   text,
+		"random": random,
+		"mixed":  append(append(append([]byte{}, text[:70000]...), random...), text...),
+		// long rep matches skip the match finder for much more than the
+		// dictionary size
+		"repeated": bytes.Repeat(text[:3000], 1000),
+	}
+
+	fast, err := LZMAPreset(0, false)
+	assert.Nil(t, err)
+	fast.DictSize = lzmaMinDictSize
+	normal, err := LZMAPreset(6, false)
+	assert.Nil(t, err)
+	literals := normal
+	literals.LC, literals.LP, literals.PB = 0, 4, 4
+
+	for name, input := range inputs {
+		for _, opts := range []LZMAOptions{fast, normal, literals} {
+			decoded := lzma2RoundTrip(t, opts, input, 4097)
+			assert.True(t, bytes.Equal(decoded, input), "%s should round trip with %+v", name, opts)
+		}
+	}
+}
+
+func TestXZDecodeLargeDictSize(t *testing.T) {
+	// test1.txt.xz with its Block Header changed to ask for a 4 GiB
+	// dictionary
+	compressed := readFixture(t, "test1.txt.xz")
+	header := compressed[12:24]
+	header[4] = 40
+	binary.LittleEndian.PutUint32(header[8:], crc32.ChecksumIEEE(header[:8]))
+	expected := readFixture(t, "test1.txt")
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	r, err := xz.NewReader(bytes.NewReader(compressed))
+	assert.Nil(t, err)
+	actual, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, actual, expected)
+
+	var pushed bytes.Buffer
+	dec := xz.NewDecoder(func(p []byte) error {
+		pushed.Write(p)
+		return nil
+	})
+	_, err = dec.Write(compressed)
+	assert.Nil(t, err)
+	assert.Nil(t, dec.Close())
+	assert.Equal(t, pushed.Bytes(), expected)
+	runtime.ReadMemStats(&after)
+	assert.True(t, after.TotalAlloc-before.TotalAlloc < 8*xz.MegaByte,
+		"the dictionary should grow with the data, allocated %d bytes", after.TotalAlloc-before.TotalAlloc)
+}
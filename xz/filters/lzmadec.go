@@ -0,0 +1,269 @@
+package filters
+
+import (
+	"errors"
+)
+
+var errLZMA2Corrupt = errors.New("LZMA2 data is corrupt")
+var errLZMA2Distance = errors.New("LZMA2 match distance is beyond the start of the dictionary")
+
+// lzmaDictInitialSize is how much of a dictionary is allocated up front. The
+// size in the filter properties is not trusted, so the buffer only grows to it
+// as data is decoded.
+const lzmaDictInitialSize = 64 * 1024
+
+// lzmaDict is the sliding window of decoded data. It doubles as the output
+// buffer: decoded bytes stay pending until they are read out, and the decoder
+// never writes over pending bytes.
+type lzmaDict struct {
+	buf     []byte
+	size    int    // the dictionary size buf grows to before wrapping
+	pos     int    // where the next byte is written
+	full    int    // how many bytes before pos can be referred to
+	pending int    // how many bytes before pos have not been read out
+	total   uint32 // bytes written since the last reset, for pos states
+}
+
+func newLZMADict(size uint32) *lzmaDict {
+	initial := int(size)
+	if initial > lzmaDictInitialSize {
+		initial = lzmaDictInitialSize
+	}
+	return &lzmaDict{buf: make([]byte, initial), size: int(size)}
+}
+
+// reset forgets the history, it must only be done with nothing pending.
+func (d *lzmaDict) reset() {
+	d.pos = 0
+	d.full = 0
+	d.total = 0
+}
+
+// available is how many bytes can be written before pending bytes would be
+// overwritten.
+func (d *lzmaDict) available() int {
+	return d.size - d.pending
+}
+
+// getByte returns the byte dist bytes back, 1 being the last byte written.
+// Callers must check that dist <= d.full.
+func (d *lzmaDict) getByte(dist int) byte {
+	i := d.pos - dist
+	if i < 0 {
+		i += len(d.buf)
+	}
+	return d.buf[i]
+}
+
+func (d *lzmaDict) putByte(b byte) {
+	d.buf[d.pos] = b
+	d.pos++
+	if d.pos == len(d.buf) {
+		d.wrap()
+	}
+	if d.full < len(d.buf) {
+		d.full++
+	}
+	d.pending++
+	d.total++
+}
+
+// wrap is called once buf is full. It grows buf while it is smaller than the
+// dictionary, which keeps its data in place as it has not wrapped yet.
+func (d *lzmaDict) wrap() {
+	if len(d.buf) == d.size {
+		d.pos = 0
+		return
+	}
+	grown := 2 * len(d.buf)
+	if grown > d.size {
+		grown = d.size
+	}
+	buf := make([]byte, grown)
+	copy(buf, d.buf)
+	d.buf = buf
+}
+
+func (d *lzmaDict) write(p []byte) {
+	for _, b := range p {
+		d.putByte(b)
+	}
+}
+
+// repeat copies length bytes starting dist bytes back.
+func (d *lzmaDict) repeat(dist, length int) error {
+	if dist > d.full || dist <= 0 {
+		return errLZMA2Distance
+	}
+	for ; length > 0; length-- {
+		d.putByte(d.getByte(dist))
+	}
+	return nil
+}
+
+// read copies pending bytes into p.
+func (d *lzmaDict) read(p []byte) int {
+	start := d.pos - d.pending
+	if start < 0 {
+		start += len(d.buf)
+	}
+	n := 0
+	for n < len(p) && d.pending > 0 {
+		end := start + d.pending
+		if end > len(d.buf) {
+			end = len(d.buf)
+		}
+		copied := copy(p[n:], d.buf[start:end])
+		n += copied
+		d.pending -= copied
+		start = 0
+	}
+	return n
+}
+
+// lzmaDecoder decodes LZMA packets into a dictionary.
+type lzmaDecoder struct {
+	props lzmaProperties
+	probs lzmaProbs
+	state lzmaState
+	rep   [4]uint32
+	dict  *lzmaDict
+}
+
+// reset resets the state and probabilities but keeps the dictionary.
+func (d *lzmaDecoder) reset() {
+	d.probs.reset(d.props)
+	d.state = 0
+	d.rep = [4]uint32{}
+}
+
+// decode decodes packets until remaining bytes have been produced or the
+// dictionary has too little space left for the longest possible match.
+func (d *lzmaDecoder) decode(rc *rangeDecoder, remaining *int) error {
+	pbMask := uint32(1)<<d.props.pb - 1
+
+	for *remaining > 0 && d.dict.available() >= lzmaMatchMaxLen {
+		posState := d.dict.total & pbMask
+
+		if rc.decodeBit(&d.probs.isMatch[d.state][posState]) == 0 {
+			d.decodeLiteral(rc)
+			*remaining--
+			continue
+		}
+
+		var length uint32
+		if rc.decodeBit(&d.probs.isRep[d.state]) == 0 {
+			length = d.decodeLen(rc, &d.probs.len, posState)
+			d.state.updateMatch()
+			d.rep[3], d.rep[2], d.rep[1] = d.rep[2], d.rep[1], d.rep[0]
+			d.rep[0] = d.decodeDistance(rc, length)
+			if d.rep[0] == 0xFFFFFFFF {
+				// LZMA2 never uses the end of payload marker.
+				return errLZMA2Corrupt
+			}
+		} else {
+			if d.dict.full == 0 {
+				return errLZMA2Corrupt
+			}
+			if rc.decodeBit(&d.probs.isRepG0[d.state]) == 0 {
+				if rc.decodeBit(&d.probs.isRep0Long[d.state][posState]) == 0 {
+					// a single byte from rep0
+					d.state.updateShortRep()
+					if int(d.rep[0]) >= d.dict.full {
+						return errLZMA2Distance
+					}
+					d.dict.putByte(d.dict.getByte(int(d.rep[0]) + 1))
+					*remaining--
+					continue
+				}
+			} else {
+				var dist uint32
+				if rc.decodeBit(&d.probs.isRepG1[d.state]) == 0 {
+					dist = d.rep[1]
+				} else {
+					if rc.decodeBit(&d.probs.isRepG2[d.state]) == 0 {
+						dist = d.rep[2]
+					} else {
+						dist = d.rep[3]
+						d.rep[3] = d.rep[2]
+					}
+					d.rep[2] = d.rep[1]
+				}
+				d.rep[1] = d.rep[0]
+				d.rep[0] = dist
+			}
+			length = d.decodeLen(rc, &d.probs.repLen, posState)
+			d.state.updateRep()
+		}
+
+		if int(length) > *remaining {
+			return errLZMA2Corrupt
+		}
+		err := d.dict.repeat(int(d.rep[0])+1, int(length))
+		if err != nil {
+			return err
+		}
+		*remaining -= int(length)
+	}
+	return nil
+}
+
+func (d *lzmaDecoder) decodeLiteral(rc *rangeDecoder) {
+	var prevByte byte
+	if d.dict.full > 0 {
+		prevByte = d.dict.getByte(1)
+	}
+	probs := d.probs.literalProbs(d.props, d.dict.total, prevByte)
+
+	symbol := uint32(1)
+	if !d.state.isLiteral() {
+		// After a match the byte at rep0 is a good guess, decode with
+		// its bits as context until the first mismatch.
+		matchByte := uint32(d.dict.getByte(int(d.rep[0]) + 1))
+		for symbol < 0x100 {
+			matchBit := (matchByte >> 7) & 1
+			matchByte <<= 1
+			bit := rc.decodeBit(&probs[(1+matchBit)<<8+symbol])
+			symbol = symbol<<1 | bit
+			if matchBit != bit {
+				break
+			}
+		}
+	}
+	for symbol < 0x100 {
+		symbol = symbol<<1 | rc.decodeBit(&probs[symbol])
+	}
+
+	d.dict.putByte(byte(symbol))
+	d.state.updateLiteral()
+}
+
+func (d *lzmaDecoder) decodeLen(rc *rangeDecoder, probs *lzmaLenProbs, posState uint32) uint32 {
+	if rc.decodeBit(&probs.choice) == 0 {
+		return lzmaMatchMinLen + rc.decodeBitTree(probs.low[posState][:], lzmaLenLowBits)
+	}
+	if rc.decodeBit(&probs.choice2) == 0 {
+		return lzmaMatchMinLen + lzmaLenLowSymbols +
+			rc.decodeBitTree(probs.mid[posState][:], lzmaLenMidBits)
+	}
+	return lzmaMatchMinLen + lzmaLenLowSymbols + lzmaLenMidSymbols +
+		rc.decodeBitTree(probs.high[:], lzmaLenHighBits)
+}
+
+// decodeDistance decodes the zero based distance of a match of the given
+// length.
+func (d *lzmaDecoder) decodeDistance(rc *rangeDecoder, length uint32) uint32 {
+	posSlot := rc.decodeBitTree(d.probs.posSlot[lzmaLenToPosState(length)][:], lzmaPosSlotBits)
+	if posSlot < lzmaStartPosModelIndex {
+		return posSlot
+	}
+
+	numDirectBits := uint(posSlot>>1) - 1
+	dist := (2 | posSlot&1) << numDirectBits
+	if posSlot < lzmaEndPosModelIndex {
+		return dist + rc.decodeReverseBitTree(d.probs.posSpecial[dist-posSlot:], numDirectBits)
+	}
+
+	dist += rc.decodeDirectBits(numDirectBits-lzmaAlignBits) << lzmaAlignBits
+	return dist + rc.decodeReverseBitTree(d.probs.align[:], lzmaAlignBits)
+}
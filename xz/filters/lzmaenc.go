@@ -0,0 +1,602 @@
+package filters
+
+import (
+	"math/bits"
+)
+
+const lzmaHashBits = 18
+
+// lzmaWindow holds the input of the encoder: the data a match may still refer
+// to and the data not encoded yet. Positions are counted from the start of the
+// LZMA2 data. Matches are found with hash chains over the first three bytes
+// at each position.
+type lzmaWindow struct {
+	buf      []byte
+	start    int64 // position of buf[0]
+	dictSize int64
+
+	head     []uint32 // position + 1 of the last occurrence of each hash
+	chain    []uint32 // position + 1 of the previous occurrence, by position
+	inserted int64    // the next position to add to the hash chains
+}
+
+func newLZMAWindow(dictSize uint32) *lzmaWindow {
+	return &lzmaWindow{
+		dictSize: int64(dictSize),
+		head:     make([]uint32, 1<<lzmaHashBits),
+	}
+}
+
+func (w *lzmaWindow) end() int64 {
+	return w.start + int64(len(w.buf))
+}
+
+func (w *lzmaWindow) byteAt(pos int64) byte {
+	return w.buf[pos-w.start]
+}
+
+// write appends input, dropping data before keep if that frees enough space.
+func (w *lzmaWindow) write(p []byte, keep int64) {
+	if drop := keep - w.start; drop > 0 && drop >= int64(len(w.buf))/2 {
+		w.buf = w.buf[:copy(w.buf, w.buf[drop:])]
+		w.start = keep
+	}
+	w.buf = append(w.buf, p...)
+}
+
+func (w *lzmaWindow) hash(pos int64) uint32 {
+	i := pos - w.start
+	v := uint32(w.buf[i])<<16 | uint32(w.buf[i+1])<<8 | uint32(w.buf[i+2])
+	return (v * 2654435761) >> (32 - lzmaHashBits)
+}
+
+// insertUpTo adds the positions before pos to the hash chains. Positions too
+// close to the end of the input to be hashed are left for later, those that
+// have already been dropped from the window are skipped.
+func (w *lzmaWindow) insertUpTo(pos int64) {
+	if w.inserted < w.start {
+		w.inserted = w.start
+	}
+	cyclic := w.dictSize + 1
+	for ; w.inserted < pos && w.inserted+3 <= w.end(); w.inserted++ {
+		h := w.hash(w.inserted)
+		i := w.inserted % cyclic
+		if n := i + 1 - int64(len(w.chain)); n > 0 {
+			w.chain = append(w.chain, make([]uint32, n)...)
+		}
+		w.chain[i] = w.head[h]
+		w.head[h] = uint32(w.inserted + 1)
+	}
+}
+
+// matchLen is the length of the match at pos with the data dist bytes back.
+func (w *lzmaWindow) matchLen(pos, dist int64, maxLen int) int {
+	a := w.buf[pos-w.start:]
+	b := w.buf[pos-dist-w.start:]
+	n := 0
+	for n < maxLen && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// lzmaMatch is a match with a distance counted from 1.
+type lzmaMatch struct {
+	length int
+	dist   int64
+}
+
+// find appends the matches at pos to matches, each longer and further back
+// than the one before, by following at most depth links of the hash chain.
+// It stops early at niceLen. The positions before pos, but not pos itself,
+// must have been inserted.
+func (w *lzmaWindow) find(pos int64, maxLen, niceLen, depth int, matches []lzmaMatch) []lzmaMatch {
+	if maxLen < 3 || pos+3 > w.end() {
+		return matches
+	}
+
+	maxDist := pos - w.start
+	if maxDist > w.dictSize {
+		maxDist = w.dictSize
+	}
+
+	cur := w.head[w.hash(pos)]
+	var prevDist int64
+	bestLen := 2
+	for ; depth > 0 && cur != 0; depth-- {
+		// positions are stored modulo 1 << 32, a stale entry can only
+		// produce a wrong candidate, which the comparison rejects
+		dist := int64(uint32(pos) - (cur - 1))
+		if dist <= prevDist || dist > maxDist {
+			break
+		}
+		prevDist = dist
+
+		if w.byteAt(pos-dist+int64(bestLen)) == w.byteAt(pos+int64(bestLen)) {
+			length := w.matchLen(pos, dist, maxLen)
+			if length > bestLen {
+				bestLen = length
+				matches = append(matches, lzmaMatch{length, dist})
+				if length >= niceLen || length == maxLen {
+					break
+				}
+			}
+		}
+		cur = w.chain[(pos-dist)%(w.dictSize+1)]
+	}
+	return matches
+}
+
+// lzmaPacket is a literal if dist is 0, otherwise a match. Whether a match is
+// encoded with one of the repeated distances, or as a short rep if its length
+// is 1, is decided when it is encoded.
+type lzmaPacket struct {
+	length int
+	dist   int64
+}
+
+// lzmaRepIndex returns which of the repeated distances is dist, or -1.
+func lzmaRepIndex(rep *[4]uint32, dist int64) int {
+	for i, r := range rep {
+		if int64(r)+1 == dist {
+			return i
+		}
+	}
+	return -1
+}
+
+// lzmaOptimumSize is how far ahead the optimal parser plans.
+const lzmaOptimumSize = 1 << 12
+
+// lzmaNode is the cheapest known way to encode the data up to one position
+// after the start of an optimal parse.
+type lzmaNode struct {
+	price  uint32
+	prev   int
+	packet lzmaPacket
+	state  lzmaState
+	rep    [4]uint32
+}
+
+// follow sets the state and repeated distances of n to those after
+// encoding its packet after prev.
+func (n *lzmaNode) follow(prev *lzmaNode) {
+	n.state, n.rep = prev.state, prev.rep
+	switch {
+	case n.packet.dist == 0:
+		n.state.updateLiteral()
+	case n.packet.length == 1:
+		n.state.updateShortRep()
+	default:
+		i := lzmaRepIndex(&n.rep, n.packet.dist)
+		if i < 0 {
+			n.state.updateMatch()
+			copy(n.rep[1:], n.rep[:3])
+		} else {
+			n.state.updateRep()
+			copy(n.rep[1:i+1], n.rep[:i])
+		}
+		n.rep[0] = uint32(n.packet.dist - 1)
+	}
+}
+
+// lzmaEncoder chooses and encodes the LZMA packets for the data in a window.
+// In normal mode the packets are chosen by an optimal parse priced with the
+// current probabilities, like the LZMA SDK does. Fast mode is greedy with one
+// step of lazy evaluation.
+type lzmaEncoder struct {
+	props  lzmaProperties
+	probs  lzmaProbs
+	prices lzmaPrices
+	state  lzmaState
+	rep    [4]uint32
+
+	win     *lzmaWindow
+	pos     int64 // the next position to encode
+	niceLen int
+	depth   int
+	optimal bool
+
+	// matches were found at matchesPos, which has been inserted so they
+	// can not be searched for again.
+	matches    []lzmaMatch
+	matchesPos int64
+
+	// queue holds the packets planned but not encoded yet.
+	queue  []lzmaPacket
+	queued int
+	nodes  []lzmaNode
+}
+
+// reset resets the state and probabilities but keeps the window. Planned
+// packets stay valid as they do not refer to the repeated distances.
+func (e *lzmaEncoder) reset() {
+	e.probs.reset(e.props)
+	e.prices.countdown = 0
+	e.state = 0
+	e.rep = [4]uint32{}
+}
+
+// lookahead is how much input must follow the position being encoded, unless
+// the input is finished, for the parser to see everything it can use.
+func (e *lzmaEncoder) lookahead() int64 {
+	if e.optimal {
+		return lzmaOptimumSize + lzmaMatchMaxLen
+	}
+	return lzmaMatchMaxLen + 1
+}
+
+func (e *lzmaEncoder) maxLen(pos int64) int {
+	if avail := e.win.end() - pos; avail < lzmaMatchMaxLen {
+		return int(avail)
+	}
+	return lzmaMatchMaxLen
+}
+
+func (e *lzmaEncoder) findMatches(pos int64, maxLen int) []lzmaMatch {
+	if pos == e.matchesPos {
+		return e.matches
+	}
+	e.win.insertUpTo(pos)
+	e.matches = e.win.find(pos, maxLen, e.niceLen, e.depth, e.matches[:0])
+	e.matchesPos = pos
+	e.win.insertUpTo(pos + 1)
+	return e.matches
+}
+
+// repLen is the length of the match at pos with the repeated distance rep.
+func (e *lzmaEncoder) repLen(pos int64, rep uint32, maxLen int) int {
+	dist := int64(rep) + 1
+	if dist > pos-e.win.start {
+		return 0
+	}
+	return e.win.matchLen(pos, dist, maxLen)
+}
+
+// encodeSymbol encodes the next packet and returns how many bytes it covered.
+func (e *lzmaEncoder) encodeSymbol(rc *rangeEncoder) int {
+	if e.queued == len(e.queue) {
+		e.queue, e.queued = e.queue[:0], 0
+		if e.optimal {
+			e.optimum()
+		} else {
+			e.queue = append(e.queue, e.greedy())
+		}
+	}
+	p := e.queue[e.queued]
+	e.queued++
+	e.encodePacket(rc, p)
+	return p.length
+}
+
+func (e *lzmaEncoder) encodePacket(rc *rangeEncoder, p lzmaPacket) {
+	posState := uint32(e.pos) & (1<<e.props.pb - 1)
+	switch {
+	case p.dist == 0:
+		e.encodeLiteral(rc, posState)
+	case p.length == 1:
+		if int64(e.rep[0])+1 == p.dist {
+			e.encodeShortRep(rc, posState)
+		} else {
+			e.encodeLiteral(rc, posState)
+		}
+	default:
+		if i := lzmaRepIndex(&e.rep, p.dist); i >= 0 {
+			e.encodeRep(rc, posState, i, p.length)
+		} else {
+			e.encodeMatch(rc, posState, lzmaMatch{p.length, p.dist})
+		}
+	}
+	e.prices.countdown--
+}
+
+func (e *lzmaEncoder) greedy() lzmaPacket {
+	literal := lzmaPacket{1, 0}
+	maxLen := e.maxLen(e.pos)
+	if maxLen < lzmaMatchMinLen {
+		return literal
+	}
+
+	var rep lzmaPacket
+	for _, r := range e.rep {
+		if length := e.repLen(e.pos, r, maxLen); length > rep.length {
+			rep = lzmaPacket{length, int64(r) + 1}
+		}
+	}
+	if rep.length >= e.niceLen {
+		return rep
+	}
+
+	var main lzmaMatch
+	if matches := e.findMatches(e.pos, maxLen); len(matches) > 0 {
+		main = matches[len(matches)-1]
+	}
+	if main.length >= e.niceLen {
+		return lzmaPacket{main.length, main.dist}
+	}
+	// a short match far back costs more than the literals it replaces
+	if main.length == 3 && main.dist > 1<<12 {
+		main.length = 0
+	}
+
+	if rep.length >= lzmaMatchMinLen &&
+		(rep.length+1 >= main.length || (rep.length+2 >= main.length && main.dist > 1<<9)) {
+		return rep
+	}
+	if main.length < 3 {
+		return literal
+	}
+
+	if matches := e.findMatches(e.pos+1, maxLen-1); len(matches) > 0 &&
+		matches[len(matches)-1].length > main.length {
+		return literal
+	}
+	return lzmaPacket{main.length, main.dist}
+}
+
+// optimum plans the packets for the data at pos by finding the cheapest path
+// through the possible packets, up to a position that all the candidates
+// found so far end at, a long match, or the planning limit.
+func (e *lzmaEncoder) optimum() {
+	maxLen := e.maxLen(e.pos)
+	if maxLen < lzmaMatchMinLen {
+		e.queue = append(e.queue, lzmaPacket{1, 0})
+		return
+	}
+
+	matches := e.findMatches(e.pos, maxLen)
+	var rep lzmaPacket
+	for _, r := range e.rep {
+		if length := e.repLen(e.pos, r, maxLen); length > rep.length {
+			rep = lzmaPacket{length, int64(r) + 1}
+		}
+	}
+	if rep.length >= e.niceLen {
+		e.queue = append(e.queue, rep)
+		return
+	}
+	if len(matches) > 0 && matches[len(matches)-1].length >= e.niceLen {
+		m := matches[len(matches)-1]
+		e.queue = append(e.queue, lzmaPacket{m.length, m.dist})
+		return
+	}
+
+	if e.prices.countdown <= 0 {
+		e.prices.update(&e.probs, e.props)
+	}
+	if e.nodes == nil {
+		e.nodes = make([]lzmaNode, lzmaOptimumSize)
+	}
+	nodes := e.nodes
+	nodes[0] = lzmaNode{state: e.state, rep: e.rep}
+
+	lenEnd := 0
+	cur := 0
+	for {
+		if cur > 0 {
+			if cur == lenEnd || cur+lzmaMatchMaxLen >= lzmaOptimumSize {
+				break
+			}
+			nodes[cur].follow(&nodes[nodes[cur].prev])
+			pos := e.pos + int64(cur)
+			matches = e.findMatches(pos, e.maxLen(pos))
+			if len(matches) > 0 && matches[len(matches)-1].length >= e.niceLen {
+				// leave the long match to start the next plan
+				break
+			}
+		}
+		lenEnd = e.expand(cur, matches, lenEnd)
+		cur++
+	}
+
+	n := 0
+	for i := cur; i > 0; i = nodes[i].prev {
+		n++
+	}
+	for i := 0; i < n; i++ {
+		e.queue = append(e.queue, lzmaPacket{})
+	}
+	for i := cur; i > 0; i = nodes[i].prev {
+		n--
+		e.queue[n] = nodes[i].packet
+	}
+}
+
+// expand prices every packet that can be encoded at node cur of the optimal
+// parse and returns the new furthest node reached.
+func (e *lzmaEncoder) expand(cur int, matches []lzmaMatch, lenEnd int) int {
+	nodes := e.nodes
+	node := &nodes[cur]
+	pos := e.pos + int64(cur)
+	maxLen := e.maxLen(pos)
+	state := node.state
+	posState := uint32(pos) & (1<<e.props.pb - 1)
+
+	try := func(packet lzmaPacket, price uint32) {
+		next := cur + packet.length
+		for lenEnd < next {
+			lenEnd++
+			nodes[lenEnd].price = lzmaInfinityPrice
+		}
+		if price < nodes[next].price {
+			nodes[next].price = price
+			nodes[next].prev = cur
+			nodes[next].packet = packet
+		}
+	}
+
+	b := e.win.byteAt(pos)
+	var prevByte, matchByte byte
+	if pos > 0 {
+		prevByte = e.win.byteAt(pos - 1)
+	}
+	rep0 := int64(node.rep[0]) + 1
+	haveRep0 := rep0 <= pos-e.win.start
+	if haveRep0 {
+		matchByte = e.win.byteAt(pos - rep0)
+	}
+
+	try(lzmaPacket{1, 0}, node.price+lzmaBitPrice(e.probs.isMatch[state][posState], 0)+
+		e.literalPrice(pos, state, prevByte, matchByte, b))
+
+	matchPrice := node.price + lzmaBitPrice(e.probs.isMatch[state][posState], 1)
+	repMatchPrice := matchPrice + lzmaBitPrice(e.probs.isRep[state], 1)
+	if haveRep0 && matchByte == b {
+		try(lzmaPacket{1, rep0}, repMatchPrice+e.shortRepPrice(state, posState))
+	}
+	if maxLen < lzmaMatchMinLen {
+		return lenEnd
+	}
+
+	startLen := lzmaMatchMinLen
+	for i, r := range node.rep {
+		dist := int64(r) + 1
+		if lzmaRepIndex(&node.rep, dist) != i {
+			// encoded with the lower index
+			continue
+		}
+		length := e.repLen(pos, r, maxLen)
+		if length < lzmaMatchMinLen {
+			continue
+		}
+		if i == 0 {
+			startLen = length + 1
+		}
+		price := repMatchPrice + e.repPrice(i, state, posState)
+		for ; length >= lzmaMatchMinLen; length-- {
+			try(lzmaPacket{length, dist}, price+e.prices.repLen[posState][length-lzmaMatchMinLen])
+		}
+	}
+
+	normalMatchPrice := matchPrice + lzmaBitPrice(e.probs.isRep[state], 0)
+	length := startLen
+	for _, m := range matches {
+		for ; length <= m.length; length++ {
+			try(lzmaPacket{length, m.dist}, normalMatchPrice+
+				e.prices.len[posState][length-lzmaMatchMinLen]+
+				e.prices.distPrice(uint32(m.dist-1), length))
+		}
+	}
+	return lenEnd
+}
+
+func (e *lzmaEncoder) encodeLiteral(rc *rangeEncoder, posState uint32) {
+	rc.encodeBit(&e.probs.isMatch[e.state][posState], 0)
+
+	var prevByte byte
+	if e.pos > 0 {
+		prevByte = e.win.byteAt(e.pos - 1)
+	}
+	probs := e.probs.literalProbs(e.props, uint32(e.pos), prevByte)
+	b := uint32(e.win.byteAt(e.pos))
+
+	symbol := uint32(1)
+	i := 7
+	if !e.state.isLiteral() {
+		matchByte := uint32(e.win.byteAt(e.pos - int64(e.rep[0]) - 1))
+		for ; i >= 0; i-- {
+			bit := (b >> uint(i)) & 1
+			matchBit := (matchByte >> uint(i)) & 1
+			rc.encodeBit(&probs[(1+matchBit)<<8+symbol], bit)
+			symbol = symbol<<1 | bit
+			if matchBit != bit {
+				i--
+				break
+			}
+		}
+	}
+	for ; i >= 0; i-- {
+		bit := (b >> uint(i)) & 1
+		rc.encodeBit(&probs[symbol], bit)
+		symbol = symbol<<1 | bit
+	}
+	e.state.updateLiteral()
+}
+
+func (e *lzmaEncoder) encodeMatch(rc *rangeEncoder, posState uint32, m lzmaMatch) {
+	rc.encodeBit(&e.probs.isMatch[e.state][posState], 1)
+	rc.encodeBit(&e.probs.isRep[e.state], 0)
+	e.encodeLen(rc, &e.probs.len, posState, m.length)
+	e.encodeDistance(rc, uint32(m.dist-1), m.length)
+	e.state.updateMatch()
+	e.rep[3], e.rep[2], e.rep[1], e.rep[0] = e.rep[2], e.rep[1], e.rep[0], uint32(m.dist-1)
+}
+
+func (e *lzmaEncoder) encodeRep(rc *rangeEncoder, posState uint32, index, length int) {
+	rc.encodeBit(&e.probs.isMatch[e.state][posState], 1)
+	rc.encodeBit(&e.probs.isRep[e.state], 1)
+	if index == 0 {
+		rc.encodeBit(&e.probs.isRepG0[e.state], 0)
+		rc.encodeBit(&e.probs.isRep0Long[e.state][posState], 1)
+	} else {
+		rc.encodeBit(&e.probs.isRepG0[e.state], 1)
+		if index == 1 {
+			rc.encodeBit(&e.probs.isRepG1[e.state], 0)
+		} else {
+			rc.encodeBit(&e.probs.isRepG1[e.state], 1)
+			rc.encodeBit(&e.probs.isRepG2[e.state], uint32(index-2))
+		}
+		dist := e.rep[index]
+		copy(e.rep[1:index+1], e.rep[:index])
+		e.rep[0] = dist
+	}
+	e.encodeLen(rc, &e.probs.repLen, posState, length)
+	e.state.updateRep()
+}
+
+func (e *lzmaEncoder) encodeShortRep(rc *rangeEncoder, posState uint32) {
+	rc.encodeBit(&e.probs.isMatch[e.state][posState], 1)
+	rc.encodeBit(&e.probs.isRep[e.state], 1)
+	rc.encodeBit(&e.probs.isRepG0[e.state], 0)
+	rc.encodeBit(&e.probs.isRep0Long[e.state][posState], 0)
+	e.state.updateShortRep()
+}
+
+func (e *lzmaEncoder) encodeLen(rc *rangeEncoder, probs *lzmaLenProbs, posState uint32, length int) {
+	l := uint32(length - lzmaMatchMinLen)
+	if l < lzmaLenLowSymbols {
+		rc.encodeBit(&probs.choice, 0)
+		rc.encodeBitTree(probs.low[posState][:], lzmaLenLowBits, l)
+		return
+	}
+	rc.encodeBit(&probs.choice, 1)
+	l -= lzmaLenLowSymbols
+	if l < lzmaLenMidSymbols {
+		rc.encodeBit(&probs.choice2, 0)
+		rc.encodeBitTree(probs.mid[posState][:], lzmaLenMidBits, l)
+		return
+	}
+	rc.encodeBit(&probs.choice2, 1)
+	rc.encodeBitTree(probs.high[:], lzmaLenHighBits, l-lzmaLenMidSymbols)
+}
+
+// encodeDistance encodes the zero based distance of a match of the given
+// length.
+func (e *lzmaEncoder) encodeDistance(rc *rangeEncoder, dist uint32, length int) {
+	posSlot := lzmaPosSlot(dist)
+	rc.encodeBitTree(e.probs.posSlot[lzmaLenToPosState(uint32(length))][:], lzmaPosSlotBits, posSlot)
+	if posSlot < lzmaStartPosModelIndex {
+		return
+	}
+
+	numDirectBits := uint(posSlot>>1) - 1
+	base := (2 | posSlot&1) << numDirectBits
+	reduced := dist - base
+	if posSlot < lzmaEndPosModelIndex {
+		rc.encodeReverseBitTree(e.probs.posSpecial[base-posSlot:], numDirectBits, reduced)
+		return
+	}
+
+	rc.encodeDirectBits(reduced>>lzmaAlignBits, numDirectBits-lzmaAlignBits)
+	rc.encodeReverseBitTree(e.probs.align[:], lzmaAlignBits, reduced&(lzmaAlignSize-1))
+}
+
+// lzmaPosSlot is the slot of a zero based distance: its two highest bits and
+// the position of the highest one.
+func lzmaPosSlot(dist uint32) uint32 {
+	if dist < lzmaStartPosModelIndex {
+		return dist
+	}
+	n := uint32(bits.Len32(dist)) - 1
+	return n<<1 | (dist>>(n-1))&1
+}
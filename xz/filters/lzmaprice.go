@@ -0,0 +1,181 @@
+package filters
+
+import (
+	"math"
+)
+
+const (
+	// Prices estimate the size of encoded data in 1/16ths of a bit.
+	lzmaPriceBits       = 4
+	lzmaPriceReduceBits = 4
+	lzmaInfinityPrice   = 1 << 30
+
+	lzmaLenSymbols = lzmaLenLowSymbols + lzmaLenMidSymbols + lzmaLenHighSymbols
+
+	// lzmaPriceInterval is how many packets are encoded between updates of
+	// the price tables.
+	lzmaPriceInterval = 256
+)
+
+// lzmaProbPrices is the price of a bit that had the given probability,
+// reduced to its top bits.
+var lzmaProbPrices [1 << (lzmaProbBits - lzmaPriceReduceBits)]uint32
+
+func init() {
+	for i := range lzmaProbPrices {
+		p := (float64(i<<lzmaPriceReduceBits) + 1<<(lzmaPriceReduceBits-1)) / (1 << lzmaProbBits)
+		lzmaProbPrices[i] = uint32(-math.Log2(p)*(1<<lzmaPriceBits) + 0.5)
+	}
+}
+
+func lzmaBitPrice(prob lzmaProb, bit uint32) uint32 {
+	if bit == 0 {
+		return lzmaProbPrices[prob>>lzmaPriceReduceBits]
+	}
+	return lzmaProbPrices[(1<<lzmaProbBits-prob)>>lzmaPriceReduceBits]
+}
+
+func lzmaBitTreePrice(probs []lzmaProb, numBits uint, symbol uint32) uint32 {
+	var price uint32
+	m := uint32(1)
+	for numBits > 0 {
+		numBits--
+		bit := (symbol >> numBits) & 1
+		price += lzmaBitPrice(probs[m], bit)
+		m = m<<1 | bit
+	}
+	return price
+}
+
+func lzmaReverseBitTreePrice(probs []lzmaProb, numBits uint, symbol uint32) uint32 {
+	var price uint32
+	m := uint32(1)
+	for i := uint(0); i < numBits; i++ {
+		bit := symbol & 1
+		symbol >>= 1
+		price += lzmaBitPrice(probs[m], bit)
+		m = m<<1 | bit
+	}
+	return price
+}
+
+// lzmaPrices caches the prices of lengths and distances, which are too slow
+// to work out for every candidate match.
+type lzmaPrices struct {
+	len     [lzmaPosStatesMax][lzmaLenSymbols]uint32
+	repLen  [lzmaPosStatesMax][lzmaLenSymbols]uint32
+	posSlot [lzmaLenToPosStates][1 << lzmaPosSlotBits]uint32
+	dist    [lzmaLenToPosStates][lzmaNumFullDistances]uint32
+	align   [lzmaAlignSize]uint32
+
+	// countdown is how many packets are left until the next update.
+	countdown int
+}
+
+func (p *lzmaPrices) update(probs *lzmaProbs, props lzmaProperties) {
+	for posState := 0; posState < 1<<props.pb; posState++ {
+		p.updateLen(&p.len[posState], &probs.len, posState)
+		p.updateLen(&p.repLen[posState], &probs.repLen, posState)
+	}
+
+	for lps := range p.posSlot {
+		for slot := uint32(0); slot < 1<<lzmaPosSlotBits; slot++ {
+			price := lzmaBitTreePrice(probs.posSlot[lps][:], lzmaPosSlotBits, slot)
+			if slot >= lzmaEndPosModelIndex {
+				price += (slot>>1 - 1 - lzmaAlignBits) << lzmaPriceBits
+			}
+			p.posSlot[lps][slot] = price
+		}
+		for dist := uint32(0); dist < lzmaNumFullDistances; dist++ {
+			slot := lzmaPosSlot(dist)
+			price := p.posSlot[lps][slot]
+			if slot >= lzmaStartPosModelIndex {
+				numDirectBits := uint(slot>>1) - 1
+				base := (2 | slot&1) << numDirectBits
+				price += lzmaReverseBitTreePrice(probs.posSpecial[base-slot:], numDirectBits, dist-base)
+			}
+			p.dist[lps][dist] = price
+		}
+	}
+
+	for i := range p.align {
+		p.align[i] = lzmaReverseBitTreePrice(probs.align[:], lzmaAlignBits, uint32(i))
+	}
+	p.countdown = lzmaPriceInterval
+}
+
+func (p *lzmaPrices) updateLen(prices *[lzmaLenSymbols]uint32, probs *lzmaLenProbs, posState int) {
+	choice0 := lzmaBitPrice(probs.choice, 0)
+	choice1 := lzmaBitPrice(probs.choice, 1)
+	mid := choice1 + lzmaBitPrice(probs.choice2, 0)
+	high := choice1 + lzmaBitPrice(probs.choice2, 1)
+
+	for l := uint32(0); l < lzmaLenSymbols; l++ {
+		switch {
+		case l < lzmaLenLowSymbols:
+			prices[l] = choice0 + lzmaBitTreePrice(probs.low[posState][:], lzmaLenLowBits, l)
+		case l < lzmaLenLowSymbols+lzmaLenMidSymbols:
+			prices[l] = mid + lzmaBitTreePrice(probs.mid[posState][:], lzmaLenMidBits, l-lzmaLenLowSymbols)
+		default:
+			prices[l] = high + lzmaBitTreePrice(probs.high[:], lzmaLenHighBits, l-lzmaLenLowSymbols-lzmaLenMidSymbols)
+		}
+	}
+}
+
+// distPrice is the price of the zero based distance of a match of the given
+// length.
+func (p *lzmaPrices) distPrice(dist uint32, length int) uint32 {
+	lps := lzmaLenToPosState(uint32(length))
+	if dist < lzmaNumFullDistances {
+		return p.dist[lps][dist]
+	}
+	return p.posSlot[lps][lzmaPosSlot(dist)] + p.align[dist&(lzmaAlignSize-1)]
+}
+
+// literalPrice is the price of encoding b as a literal, matchByte is used if
+// the state calls for a matched literal.
+func (e *lzmaEncoder) literalPrice(pos int64, state lzmaState, prevByte, matchByte, b byte) uint32 {
+	probs := e.probs.literalProbs(e.props, uint32(pos), prevByte)
+
+	var price uint32
+	symbol := uint32(1)
+	i := 7
+	if !state.isLiteral() {
+		for ; i >= 0; i-- {
+			bit := uint32(b>>uint(i)) & 1
+			matchBit := uint32(matchByte>>uint(i)) & 1
+			price += lzmaBitPrice(probs[(1+matchBit)<<8+symbol], bit)
+			symbol = symbol<<1 | bit
+			if matchBit != bit {
+				i--
+				break
+			}
+		}
+	}
+	for ; i >= 0; i-- {
+		bit := uint32(b>>uint(i)) & 1
+		price += lzmaBitPrice(probs[symbol], bit)
+		symbol = symbol<<1 | bit
+	}
+	return price
+}
+
+// repPrice is the price of choosing repeated distance index, not counting
+// the isMatch and isRep bits or the length.
+func (e *lzmaEncoder) repPrice(index int, state lzmaState, posState uint32) uint32 {
+	if index == 0 {
+		return lzmaBitPrice(e.probs.isRepG0[state], 0) +
+			lzmaBitPrice(e.probs.isRep0Long[state][posState], 1)
+	}
+	price := lzmaBitPrice(e.probs.isRepG0[state], 1)
+	if index == 1 {
+		return price + lzmaBitPrice(e.probs.isRepG1[state], 0)
+	}
+	return price + lzmaBitPrice(e.probs.isRepG1[state], 1) +
+		lzmaBitPrice(e.probs.isRepG2[state], uint32(index-2))
+}
+
+func (e *lzmaEncoder) shortRepPrice(state lzmaState, posState uint32) uint32 {
+	return lzmaBitPrice(e.probs.isRepG0[state], 0) +
+		lzmaBitPrice(e.probs.isRep0Long[state][posState], 0)
+}
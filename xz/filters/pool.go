@@ -0,0 +1,51 @@
+package filters
+
+import (
+	"sync"
+)
+
+// lzmaDictSizes is the number of valid LZMADictSize values.
+const lzmaDictSizes = 41
+
+// Finished LZMA2 readers and writers give their dictionaries and windows back
+// to these pools, so that decoding many small payloads does not allocate a
+// dictionary each time. A buffer can only be reused at the same size, so there
+// is a pool for each LZMADictSize.
+var (
+	lzmaDictPools   [lzmaDictSizes]sync.Pool
+	lzmaWindowPools [lzmaDictSizes]sync.Pool
+	lzma2ChunkPool  = sync.Pool{New: func() interface{} {
+		return new([lzma2MaxCompressedChunk]byte)
+	}}
+)
+
+// getLZMADict returns an empty dictionary of the given size.
+func getLZMADict(key LZMADictSize, size uint32) *lzmaDict {
+	if d, ok := lzmaDictPools[key].Get().(*lzmaDict); ok {
+		*d = lzmaDict{buf: d.buf, size: d.size}
+		return d
+	}
+	return newLZMADict(size)
+}
+
+func putLZMADict(key LZMADictSize, d *lzmaDict) {
+	lzmaDictPools[key].Put(d)
+}
+
+// getLZMAWindow returns an empty window for dictSize, which has to fit key.
+func getLZMAWindow(key LZMADictSize, dictSize uint32) *lzmaWindow {
+	w, ok := lzmaWindowPools[key].Get().(*lzmaWindow)
+	if !ok {
+		return newLZMAWindow(dictSize)
+	}
+	// stale hash chain entries are unreachable once the heads are cleared
+	for i := range w.head {
+		w.head[i] = 0
+	}
+	*w = lzmaWindow{buf: w.buf[:0], dictSize: int64(dictSize), head: w.head, chain: w.chain}
+	return w
+}
+
+func putLZMAWindow(key LZMADictSize, w *lzmaWindow) {
+	lzmaWindowPools[key].Put(w)
+}
@@ -0,0 +1,138 @@
+package filters
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+func TestXZReaderReset(t *testing.T) {
+	var r *xz.Reader
+	// twice, so the second round decodes with pooled dictionaries
+	for round := 0; round < 2; round++ {
+		for _, fixture := range xzFixtures {
+			compressed := readFixture(t, fixture.compressed)
+			var err error
+			if r == nil {
+				r, err = xz.NewReader(bytes.NewReader(compressed))
+			} else {
+				err = r.Reset(bytes.NewReader(compressed))
+			}
+			assert.Nil(t, err, fixture.compressed)
+			actual, err := ioutil.ReadAll(r)
+			assert.Nil(t, err, fixture.compressed)
+			assert.Equal(t, actual, readFixture(t, fixture.original), "%s after Reset", fixture.compressed)
+		}
+	}
+}
+
+func TestXZWriterReset(t *testing.T) {
+	chain, err := ParseFilterChain("lzma2:preset=1")
+	assert.Nil(t, err)
+	inputs := [][]byte{readFixture(t, "test2.txt"), readFixture(t, "test1.txt"), readFixture(t, "bcj/arm64.bin")}
+
+	var w *xz.Writer
+	for _, input := range inputs {
+		var compressed bytes.Buffer
+		if w == nil {
+			w, err = xz.NewWriter(&compressed, xz.WriterConfig{Filters: chain, BlockSize: 100 * xz.KiloByte})
+		} else {
+			err = w.Reset(&compressed)
+		}
+		assert.Nil(t, err)
+		_, err = w.Write(input)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+
+		r, err := xz.NewReader(&compressed)
+		assert.Nil(t, err)
+		actual, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, actual, input, "the Stream written after Reset should decode")
+	}
+}
+
+// The benchmarks decode and encode a small payload over and over, with and
+// without Reset, and report the allocations of each.
+
+func BenchmarkDecodeNewReader(b *testing.B) {
+	compressed := readFixture(b, "test1.txt.xz")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r, err := xz.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = io.Copy(ioutil.Discard, r)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeReset(b *testing.B) {
+	compressed := readFixture(b, "test1.txt.xz")
+	in := bytes.NewReader(compressed)
+	r, err := xz.NewReader(in)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in.Reset(compressed)
+		err = r.Reset(in)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = io.Copy(ioutil.Discard, r)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkEncode(b *testing.B, reset bool) {
+	input := readFixture(b, "test1.txt")
+	chain, err := ParseFilterChain("lzma2:preset=1")
+	if err != nil {
+		b.Fatal(err)
+	}
+	config := xz.WriterConfig{Filters: chain}
+	w, err := xz.NewWriter(ioutil.Discard, config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if reset {
+			err = w.Reset(ioutil.Discard)
+		} else {
+			w, err = xz.NewWriter(ioutil.Discard, config)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = w.Write(input)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeNewWriter(b *testing.B) {
+	benchmarkEncode(b, false)
+}
+
+func BenchmarkEncodeReset(b *testing.B) {
+	benchmarkEncode(b, true)
+}
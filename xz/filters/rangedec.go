@@ -0,0 +1,106 @@
+package filters
+
+const rangeTopValue = 1 << 24
+
+// rangeDecoder decodes bits from one LZMA2 chunk. The whole chunk is buffered
+// so that decoding a bit never has to deal with read errors: running off the
+// end of buf is recorded in overrun and reported once the chunk is done.
+type rangeDecoder struct {
+	buf     []byte
+	pos     int
+	overrun bool
+
+	rng  uint32
+	code uint32
+}
+
+func (rc *rangeDecoder) nextByte() byte {
+	if rc.pos >= len(rc.buf) {
+		rc.overrun = true
+		return 0
+	}
+	b := rc.buf[rc.pos]
+	rc.pos++
+	return b
+}
+
+// init starts decoding buf, returning false if it does not start with the
+// null byte every range encoder emits first.
+func (rc *rangeDecoder) init(buf []byte) bool {
+	rc.buf = buf
+	rc.pos = 0
+	rc.overrun = false
+	rc.rng = 0xFFFFFFFF
+	rc.code = 0
+
+	first := rc.nextByte()
+	for i := 0; i < 4; i++ {
+		rc.code = rc.code<<8 | uint32(rc.nextByte())
+	}
+	return first == 0x00
+}
+
+// finished reports whether exactly the whole chunk was used, which is also
+// when the encoder has flushed all of its state.
+func (rc *rangeDecoder) finished() bool {
+	return !rc.overrun && rc.pos == len(rc.buf) && rc.code == 0
+}
+
+func (rc *rangeDecoder) normalize() {
+	if rc.rng < rangeTopValue {
+		rc.rng <<= 8
+		rc.code = rc.code<<8 | uint32(rc.nextByte())
+	}
+}
+
+func (rc *rangeDecoder) decodeBit(prob *lzmaProb) uint32 {
+	bound := (rc.rng >> lzmaProbBits) * uint32(*prob)
+	var bit uint32
+	if rc.code < bound {
+		rc.rng = bound
+		*prob += (1<<lzmaProbBits - *prob) >> lzmaMoveBits
+	} else {
+		rc.rng -= bound
+		rc.code -= bound
+		*prob -= *prob >> lzmaMoveBits
+		bit = 1
+	}
+	rc.normalize()
+	return bit
+}
+
+// decodeDirectBits decodes bits with a fixed probability of one half.
+func (rc *rangeDecoder) decodeDirectBits(count uint) uint32 {
+	var result uint32
+	for ; count > 0; count-- {
+		rc.rng >>= 1
+		rc.code -= rc.rng
+		t := 0 - (rc.code >> 31)
+		rc.code += rc.rng & t
+		result = result<<1 + t + 1
+		rc.normalize()
+	}
+	return result
+}
+
+// decodeBitTree decodes numBits bits, most significant first, using
+// probs[1:1<<numBits] as a binary tree of probabilities.
+func (rc *rangeDecoder) decodeBitTree(probs []lzmaProb, numBits uint) uint32 {
+	m := uint32(1)
+	for i := uint(0); i < numBits; i++ {
+		m = m<<1 | rc.decodeBit(&probs[m])
+	}
+	return m - 1<<numBits
+}
+
+// decodeReverseBitTree is decodeBitTree with the least significant bit first.
+func (rc *rangeDecoder) decodeReverseBitTree(probs []lzmaProb, numBits uint) uint32 {
+	m := uint32(1)
+	var symbol uint32
+	for i := uint(0); i < numBits; i++ {
+		bit := rc.decodeBit(&probs[m])
+		m = m<<1 | bit
+		symbol |= bit << i
+	}
+	return symbol
+}
@@ -0,0 +1,101 @@
+package filters
+
+// rangeEncoder encodes the bits of one LZMA2 chunk into out, it is the mirror
+// image of rangeDecoder.
+type rangeEncoder struct {
+	out []byte
+
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int
+}
+
+func (rc *rangeEncoder) init() {
+	rc.out = rc.out[:0]
+	rc.low = 0
+	rc.rng = 0xFFFFFFFF
+	rc.cache = 0
+	rc.cacheSize = 1
+}
+
+// pending is an upper bound on the number of bytes flush will add to out.
+func (rc *rangeEncoder) pending() int {
+	return rc.cacheSize + 4
+}
+
+// shiftLow moves the top byte of low out of the encoder. A byte is held back
+// in cache, along with any 0xFF bytes after it, until it is known whether a
+// carry will propagate into it.
+func (rc *rangeEncoder) shiftLow() {
+	if uint32(rc.low) < 0xFF000000 || rc.low >= 1<<32 {
+		carry := byte(rc.low >> 32)
+		b := rc.cache
+		for ; rc.cacheSize > 0; rc.cacheSize-- {
+			rc.out = append(rc.out, b+carry)
+			b = 0xFF
+		}
+		rc.cache = byte(rc.low >> 24)
+	}
+	rc.cacheSize++
+	rc.low = (rc.low & 0x00FFFFFF) << 8
+}
+
+func (rc *rangeEncoder) flush() {
+	for i := 0; i < 5; i++ {
+		rc.shiftLow()
+	}
+}
+
+func (rc *rangeEncoder) normalize() {
+	for rc.rng < rangeTopValue {
+		rc.rng <<= 8
+		rc.shiftLow()
+	}
+}
+
+func (rc *rangeEncoder) encodeBit(prob *lzmaProb, bit uint32) {
+	bound := (rc.rng >> lzmaProbBits) * uint32(*prob)
+	if bit == 0 {
+		rc.rng = bound
+		*prob += (1<<lzmaProbBits - *prob) >> lzmaMoveBits
+	} else {
+		rc.low += uint64(bound)
+		rc.rng -= bound
+		*prob -= *prob >> lzmaMoveBits
+	}
+	rc.normalize()
+}
+
+// encodeDirectBits encodes the low count bits of value, most significant
+// first, with a fixed probability of one half.
+func (rc *rangeEncoder) encodeDirectBits(value uint32, count uint) {
+	for count > 0 {
+		count--
+		rc.rng >>= 1
+		if (value>>count)&1 != 0 {
+			rc.low += uint64(rc.rng)
+		}
+		rc.normalize()
+	}
+}
+
+func (rc *rangeEncoder) encodeBitTree(probs []lzmaProb, numBits uint, symbol uint32) {
+	m := uint32(1)
+	for numBits > 0 {
+		numBits--
+		bit := (symbol >> numBits) & 1
+		rc.encodeBit(&probs[m], bit)
+		m = m<<1 | bit
+	}
+}
+
+func (rc *rangeEncoder) encodeReverseBitTree(probs []lzmaProb, numBits uint, symbol uint32) {
+	m := uint32(1)
+	for i := uint(0); i < numBits; i++ {
+		bit := symbol & 1
+		symbol >>= 1
+		rc.encodeBit(&probs[m], bit)
+		m = m<<1 | bit
+	}
+}
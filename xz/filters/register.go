@@ -0,0 +1,29 @@
+package filters
+
+import (
+	"github.com/ZymoticB/goxz/xz"
+)
+
+// Importing this package registers every filter it implements with the xz
+// package, which is what lets xz.Reader decode Blocks that use them.
+func init() {
+	for _, arch := range []BCJArch{
+		BCJX86, BCJPowerPC, BCJIA64, BCJARM, BCJARMThumb, BCJSPARC, BCJARM64, BCJRISCV,
+	} {
+		arch := arch
+		xz.RegisterFilter(xz.MultiByteInteger(arch), func(props []byte) (xz.Filter, error) {
+			f := &BCJ{Arch: arch}
+			return f, f.DecodeProperties(props)
+		})
+	}
+
+	xz.RegisterFilter(xz.FilterDelta, func(props []byte) (xz.Filter, error) {
+		f := new(Delta)
+		return f, f.DecodeProperties(props)
+	})
+
+	xz.RegisterFilter(xz.FilterLZMA2, func(props []byte) (xz.Filter, error) {
+		f := new(LZMA2)
+		return f, f.DecodeProperties(props)
+	})
+}
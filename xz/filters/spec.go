@@ -0,0 +1,205 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+var errEmptyFilterSpec = errors.New("Filter chain specification is empty")
+var errLastFilterNotLZMA2 = errors.New("The last filter in a chain must be lzma2")
+var errFilterOptionFormat = errors.New("Filter options must be in the form name=value")
+
+var bcjNames = map[string]BCJArch{
+	"x86":      BCJX86,
+	"powerpc":  BCJPowerPC,
+	"ia64":     BCJIA64,
+	"arm":      BCJARM,
+	"armthumb": BCJARMThumb,
+	"arm64":    BCJARM64,
+	"sparc":    BCJSPARC,
+	"riscv":    BCJRISCV,
+}
+
+// ParseFilterChain parses a filter chain in the format of xz's --filters, a
+// list of filters separated by spaces or "--", each optionally followed by a
+// colon or equals sign and its options, for example
+// "x86 lzma2:preset=9e,dict=64MiB".
+func ParseFilterChain(spec string) (xz.FilterChain, error) {
+	var chain xz.FilterChain
+	for _, field := range strings.Fields(strings.Replace(spec, "--", " ", -1)) {
+		name, options := field, ""
+		if i := strings.IndexAny(field, ":="); i >= 0 {
+			name, options = field[:i], field[i+1:]
+		}
+		f, err := ParseFilter(name, options)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, f)
+	}
+
+	if len(chain) == 0 {
+		return nil, errEmptyFilterSpec
+	}
+	err := chain.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if chain[len(chain)-1].ID() != xz.FilterLZMA2 {
+		return nil, errLastFilterNotLZMA2
+	}
+	return chain, nil
+}
+
+// ParseFilter creates the named filter from a comma separated list of
+// name=value options, as used by xz's --lzma2=, --delta= and --x86= options.
+func ParseFilter(name, options string) (xz.Filter, error) {
+	var opts [][2]string
+	for _, opt := range strings.Split(options, ",") {
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errFilterOptionFormat
+		}
+		opts = append(opts, [2]string{kv[0], kv[1]})
+	}
+
+	if arch, ok := bcjNames[name]; ok {
+		return parseBCJ(arch, name, opts)
+	}
+	switch name {
+	case "delta":
+		return parseDelta(opts)
+	case "lzma2":
+		return parseLZMA2(opts)
+	}
+	return nil, fmt.Errorf("Unknown filter %q", name)
+}
+
+func parseBCJ(arch BCJArch, name string, opts [][2]string) (xz.Filter, error) {
+	f := &BCJ{Arch: arch}
+	for _, opt := range opts {
+		if opt[0] != "start" {
+			return nil, unknownOption(name, opt[0])
+		}
+		start, err := parseSize(opt[1], 0, 1<<32-1)
+		if err != nil {
+			return nil, optionError(name, opt, err)
+		}
+		f.StartOffset = uint32(start)
+	}
+	return f, nil
+}
+
+func parseDelta(opts [][2]string) (xz.Filter, error) {
+	f := &Delta{Distance: 1}
+	for _, opt := range opts {
+		if opt[0] != "dist" {
+			return nil, unknownOption("delta", opt[0])
+		}
+		dist, err := parseSize(opt[1], 1, deltaMaxDistance)
+		if err != nil {
+			return nil, optionError("delta", opt, err)
+		}
+		f.Distance = int(dist)
+	}
+	return f, nil
+}
+
+func parseLZMA2(opts [][2]string) (xz.Filter, error) {
+	o, err := LZMAPreset(6, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		var n uint64
+		switch opt[0] {
+		case "preset":
+			level := strings.TrimSuffix(opt[1], "e")
+			n, err = parseSize(level, 0, 9)
+			if err == nil {
+				o, err = LZMAPreset(int(n), level != opt[1])
+			}
+		case "dict":
+			n, err = parseSize(opt[1], lzmaMinDictSize, lzmaMaxDictSize)
+			o.DictSize = uint32(n)
+		case "lc":
+			n, err = parseSize(opt[1], 0, 4)
+			o.LC = uint(n)
+		case "lp":
+			n, err = parseSize(opt[1], 0, 4)
+			o.LP = uint(n)
+		case "pb":
+			n, err = parseSize(opt[1], 0, 4)
+			o.PB = uint(n)
+		case "mode":
+			switch opt[1] {
+			case "fast":
+				o.Mode = LZMAModeFast
+			case "normal":
+				o.Mode = LZMAModeNormal
+			default:
+				err = errLZMAMode
+			}
+		case "nice":
+			n, err = parseSize(opt[1], lzmaMatchMinLen, lzmaMatchMaxLen)
+			o.NiceLen = int(n)
+		case "depth":
+			n, err = parseSize(opt[1], 0, 1<<31-1)
+			o.Depth = int(n)
+		default:
+			return nil, unknownOption("lzma2", opt[0])
+		}
+		if err != nil {
+			return nil, optionError("lzma2", opt, err)
+		}
+	}
+	return NewLZMA2(o)
+}
+
+func unknownOption(filter, name string) error {
+	return fmt.Errorf("Unknown option %q for filter %s", name, filter)
+}
+
+func optionError(filter string, opt [2]string, err error) error {
+	return fmt.Errorf("Invalid value %q for %s option %s: %v", opt[1], filter, opt[0], err)
+}
+
+var sizeSuffixes = []struct {
+	suffix     string
+	multiplier uint64
+}{
+	{"kib", xz.KiloByte}, {"kb", xz.KiloByte}, {"ki", xz.KiloByte}, {"k", xz.KiloByte},
+	{"mib", xz.MegaByte}, {"mb", xz.MegaByte}, {"mi", xz.MegaByte}, {"m", xz.MegaByte},
+	{"gib", xz.GigaByte}, {"gb", xz.GigaByte}, {"gi", xz.GigaByte}, {"g", xz.GigaByte},
+}
+
+// parseSize parses an integer between min and max, which like xz may have a
+// KiB, MiB or GiB suffix.
+func parseSize(s string, min, max uint64) (uint64, error) {
+	lower := strings.ToLower(s)
+	multiplier := uint64(1)
+	for _, suffix := range sizeSuffixes {
+		if strings.HasSuffix(lower, suffix.suffix) {
+			lower = strings.TrimSuffix(lower, suffix.suffix)
+			multiplier = suffix.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseUint(lower, 10, 64)
+	if err != nil {
+		return 0, errors.New("not a number")
+	}
+	if n > max/multiplier || n*multiplier < min {
+		return 0, fmt.Errorf("must be between %d and %d", min, max)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,84 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ZymoticB/goxz/xz"
+)
+
+func TestParseFilterChain(t *testing.T) {
+	preset6, _ := LZMAPreset(6, false)
+	preset9e, _ := LZMAPreset(9, true)
+	preset9e.DictSize = 32 * xz.MegaByte
+	custom := preset6
+	custom.LC, custom.LP, custom.PB = 0, 2, 2
+	custom.Mode, custom.NiceLen, custom.Depth = LZMAModeFast, 128, 10
+
+	tests := []struct {
+		spec     string
+		expected []xz.Filter
+	}{
+		{"lzma2", []xz.Filter{mustLZMA2(t, preset6)}},
+		{"x86 lzma2:preset=9e,dict=32MiB", []xz.Filter{&BCJ{Arch: BCJX86}, mustLZMA2(t, preset9e)}},
+		{"--delta=dist=4--arm64:start=4k --lzma2", []xz.Filter{
+			&Delta{Distance: 4}, &BCJ{Arch: BCJARM64, StartOffset: 4096}, mustLZMA2(t, preset6),
+		}},
+		{"lzma2:lc=0,lp=2,mode=fast,nice=128,depth=10", []xz.Filter{mustLZMA2(t, custom)}},
+	}
+
+	for _, tt := range tests {
+		chain, err := ParseFilterChain(tt.spec)
+		assert.Nil(t, err, "%q should parse", tt.spec)
+		assert.Equal(t, []xz.Filter(chain), tt.expected, "unexpected chain for %q", tt.spec)
+	}
+}
+
+func TestParseFilterChainErrors(t *testing.T) {
+	specs := []string{
+		"",
+		"x86",
+		"lzma2 x86",
+		"zstd lzma2",
+		"x86 x86 x86 x86 lzma2",
+		"lzma2:preset=10",
+		"lzma2:preset",
+		"lzma2:dict=1k",
+		"lzma2:dict=2GiB",
+		"lzma2:lc=4,lp=1",
+		"lzma2:mode=ultra",
+		"lzma2:nice=1",
+		"lzma2:mf=bt4",
+		"delta:dist=0 lzma2",
+		"x86:start=-1 lzma2",
+	}
+	for _, spec := range specs {
+		_, err := ParseFilterChain(spec)
+		assert.NotNil(t, err, "%q should be rejected", spec)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected uint64
+	}{
+		{"17", 17},
+		{"4k", 4 * xz.KiloByte},
+		{"4KiB", 4 * xz.KiloByte},
+		{"64MiB", 64 * xz.MegaByte},
+		{"1g", xz.GigaByte},
+	}
+	for _, tt := range tests {
+		n, err := parseSize(tt.s, 0, 4*xz.GigaByte)
+		assert.Nil(t, err)
+		assert.Equal(t, n, tt.expected, "unexpected size for %q", tt.s)
+	}
+}
+
+func mustLZMA2(t *testing.T, opts LZMAOptions) *LZMA2 {
+	f, err := NewLZMA2(opts)
+	assert.Nil(t, err)
+	return f
+}
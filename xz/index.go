@@ -1,9 +1,17 @@
 package xz
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"io"
 )
 
+var errBadIndexIndicator = errors.New("Index does not start with the Index Indicator")
+var errBadIndexCRC = errors.New("Index CRC32 does not match")
+var errIndexPadding = errors.New("Index padding is not null")
+var errIndexRecords = errors.New("Index does not match the Blocks in the Stream")
+
 type IndexIndicator byte
 
 const (
@@ -19,13 +27,131 @@ type Index struct {
 	CRC32           CRC32
 }
 
-type IndexPadding [3]byte
+type IndexPadding []byte // 0-3 null bytes, up to a multiple of four
 
 type IndexRecord struct {
 	UnpaddedSize     MultiByteInteger
 	UncompressedSize MultiByteInteger
 }
 
+// crc32Reader computes the CRC32 of everything read through it.
+type crc32Reader struct {
+	r   io.Reader
+	crc uint32
+	n   int64
+}
+
+func (c *crc32Reader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc = Crc32(p, n, c.crc)
+	c.n += int64(n)
+	return n, err
+}
+
 func (i *Index) read(r io.Reader) error {
+	cr := &crc32Reader{r: r}
+
+	var indicator [1]byte
+	_, err := io.ReadFull(cr, indicator[:])
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	i.Indicator = IndexIndicator(indicator[0])
+	if i.Indicator != indexIndicator {
+		return errBadIndexIndicator
+	}
+
+	err = i.NumberOfRecords.Read(cr)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	i.Records = nil
+	for n := MultiByteInteger(0); n < i.NumberOfRecords; n++ {
+		var record IndexRecord
+		err = record.UnpaddedSize.Read(cr)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		err = record.UncompressedSize.Read(cr)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		i.Records = append(i.Records, record)
+	}
+
+	i.Padding = make(IndexPadding, (4-cr.n%4)%4)
+	_, err = io.ReadFull(cr, i.Padding)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	for _, p := range i.Padding {
+		if p != 0x00 {
+			return errIndexPadding
+		}
+	}
+
+	err = binary.Read(r, binary.LittleEndian, &i.CRC32)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if CRC32(cr.crc) != i.CRC32 {
+		return errBadIndexCRC
+	}
 	return nil
 }
+
+// size is the size of the Index once written.
+func (i *Index) size() int {
+	size := 1 + i.NumberOfRecords.size()
+	for _, record := range i.Records {
+		size += record.UnpaddedSize.size() + record.UncompressedSize.size()
+	}
+	return (size+3)&^3 + 4
+}
+
+// validate compares the Index with the Records of the Blocks decoded.
+func (i *Index) validate(records []IndexRecord) error {
+	if len(i.Records) != len(records) {
+		return errIndexRecords
+	}
+	for n, record := range records {
+		if i.Records[n] != record {
+			return errIndexRecords
+		}
+	}
+	return nil
+}
+
+// write stores the Index, filling in its Padding and CRC32.
+func (i *Index) write(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(i.Indicator))
+
+	err := i.NumberOfRecords.Write(&buf)
+	if err != nil {
+		return err
+	}
+	for _, record := range i.Records {
+		err = record.UnpaddedSize.Write(&buf)
+		if err != nil {
+			return err
+		}
+		err = record.UncompressedSize.Write(&buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	i.Padding = make(IndexPadding, (4-buf.Len()%4)%4)
+	buf.Write(i.Padding)
+
+	i.CRC32 = CRC32(Crc32(buf.Bytes(), buf.Len(), 0))
+	err = binary.Write(&buf, binary.LittleEndian, i.CRC32)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,246 @@
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var errFileSize = errors.New("File size is not a multiple of four bytes")
+var errIndexTooLarge = errors.New("Index refers to more data than the file has")
+var errUncompressedTooLarge = errors.New("Index uncompressed sizes add up to more than 2^63-1")
+
+const (
+	streamHeaderSize = 12
+	streamFooterSize = 12
+)
+
+// StreamInfo describes a Stream as found from its Stream Footer and Index.
+type StreamInfo struct {
+	Header StreamHeader
+	Footer StreamFooter
+	Index  Index
+	Blocks []BlockInfo
+
+	// Offset and UncompressedOffset are where the Stream starts in the file
+	// and in the decompressed data.
+	Offset             int64
+	UncompressedOffset int64
+	// Padding is the size of the Stream Padding after the Stream.
+	Padding int64
+}
+
+// BlockInfo describes a Block as found from its Index Record.
+type BlockInfo struct {
+	// Offset and UncompressedOffset are where the Block starts in the file
+	// and in the decompressed data.
+	Offset             int64
+	UncompressedOffset int64
+	UnpaddedSize       int64
+	UncompressedSize   int64
+
+	// Header is only read if ReadInfo is asked to.
+	Header BlockHeader
+}
+
+// TotalSize is the size of the Block including its Block Padding.
+func (b *BlockInfo) TotalSize() int64 {
+	return (b.UnpaddedSize + 3) &^ 3
+}
+
+// CompressedSize is the size of the Block's compressed data, it is only
+// known once the Block Header has been read.
+func (b *BlockInfo) CompressedSize(flags StreamFlags) int64 {
+	return b.UnpaddedSize - int64(b.Header.getRealSize()) - int64(flags.getCheckSize())
+}
+
+// CompressedSize is the size of the whole Stream, not counting its padding.
+func (s *StreamInfo) CompressedSize() int64 {
+	return streamHeaderSize + s.blocksSize() + int64(s.Footer.BackwardSize.getRealSize()) + streamFooterSize
+}
+
+// IndexSize is the size of the Index as recorded in the Stream Footer.
+func (s *StreamInfo) IndexSize() int64 {
+	return int64(s.Footer.BackwardSize.getRealSize())
+}
+
+func (s *StreamInfo) UncompressedSize() int64 {
+	var size int64
+	for _, record := range s.Index.Records {
+		size += int64(record.UncompressedSize)
+	}
+	return size
+}
+
+func (s *StreamInfo) blocksSize() int64 {
+	var size int64
+	for _, record := range s.Index.Records {
+		size += (int64(record.UnpaddedSize) + 3) &^ 3
+	}
+	return size
+}
+
+// ReadInfo reads the Streams of the xz file in r, which is size bytes long,
+// from their Stream Footers and Indexes without decompressing anything. The
+// Block Headers are read too if headers is set.
+func ReadInfo(r io.ReaderAt, size int64, headers bool) ([]StreamInfo, error) {
+	if size%4 != 0 {
+		return nil, errFileSize
+	}
+
+	var streams []StreamInfo
+	var padding int64
+	pos := size
+	for pos > 0 {
+		var word [4]byte
+		_, err := r.ReadAt(word[:], pos-4)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if word == [4]byte{} {
+			padding += 4
+			pos -= 4
+			continue
+		}
+		if pos < streamHeaderSize+streamFooterSize {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		stream := StreamInfo{Padding: padding}
+		err = stream.read(r, pos)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, stream)
+		pos = stream.Offset
+		padding = 0
+	}
+	if len(streams) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if padding > 0 {
+		return nil, errBadHeaderMagic
+	}
+
+	// the Streams were found last to first
+	for i, j := 0, len(streams)-1; i < j; i, j = i+1, j-1 {
+		streams[i], streams[j] = streams[j], streams[i]
+	}
+	var uncompressed int64
+	for i := range streams {
+		s := &streams[i]
+		if s.UncompressedSize() > math.MaxInt64-uncompressed {
+			return nil, errUncompressedTooLarge
+		}
+		s.UncompressedOffset = uncompressed
+		err := s.readBlocks(r, headers)
+		if err != nil {
+			return nil, err
+		}
+		uncompressed += s.UncompressedSize()
+	}
+	return streams, nil
+}
+
+// read reads the Stream that ends at end.
+func (s *StreamInfo) read(r io.ReaderAt, end int64) error {
+	err := s.Footer.read(io.NewSectionReader(r, end-streamFooterSize, streamFooterSize))
+	if err != nil {
+		return err
+	}
+
+	indexSize := int64(s.Footer.BackwardSize.getRealSize())
+	indexStart := end - streamFooterSize - indexSize
+	if indexStart < streamHeaderSize {
+		return errIndexTooLarge
+	}
+	err = s.Index.read(io.NewSectionReader(r, indexStart, indexSize))
+	if err != nil {
+		return err
+	}
+
+	// the Blocks have to fit before the Index, which is checked as the
+	// sizes are summed so that huge sizes can not wrap around
+	available := indexStart - streamHeaderSize
+	var blocks, uncompressed int64
+	for _, record := range s.Index.Records {
+		if int64(record.UnpaddedSize) > available-blocks {
+			return errIndexTooLarge
+		}
+		blocks += (int64(record.UnpaddedSize) + 3) &^ 3
+		if blocks > available {
+			return errIndexTooLarge
+		}
+		if int64(record.UncompressedSize) > math.MaxInt64-uncompressed {
+			return errUncompressedTooLarge
+		}
+		uncompressed += int64(record.UncompressedSize)
+	}
+	s.Offset = indexStart - blocks - streamHeaderSize
+	err = s.Header.read(io.NewSectionReader(r, s.Offset, streamHeaderSize))
+	if err != nil {
+		return err
+	}
+	return s.Footer.validate(&s.Header, &s.Index)
+}
+
+func (s *StreamInfo) readBlocks(r io.ReaderAt, headers bool) error {
+	offset := s.Offset + streamHeaderSize
+	uncompressed := s.UncompressedOffset
+	s.Blocks = make([]BlockInfo, len(s.Index.Records))
+	for i, record := range s.Index.Records {
+		b := &s.Blocks[i]
+		b.Offset = offset
+		b.UncompressedOffset = uncompressed
+		b.UnpaddedSize = int64(record.UnpaddedSize)
+		b.UncompressedSize = int64(record.UncompressedSize)
+		if headers {
+			err := b.Header.read(io.NewSectionReader(r, offset, blockHeaderMaxSize))
+			if err != nil {
+				return err
+			}
+		}
+		offset += b.TotalSize()
+		uncompressed += b.UncompressedSize
+	}
+	return nil
+}
+
+// SizesInHeader tells whether the Block Header stores the compressed and
+// uncompressed sizes of the Block.
+func (b *BlockInfo) SizesInHeader() (compressed, uncompressed bool) {
+	return b.Header.HasSizes()
+}
+
+// ReadCheck reads the Check stored at the end of the Block.
+func (b *BlockInfo) ReadCheck(r io.ReaderAt, flags StreamFlags) ([]byte, error) {
+	check := make([]byte, flags.getCheckSize())
+	_, err := r.ReadAt(check, b.Offset+b.TotalSize()-int64(len(check)))
+	return check, unexpectedEOF(err)
+}
+
+// HeaderSize is the size of the Block Header, once it has been read.
+func (b *BlockInfo) HeaderSize() int {
+	return b.Header.Size()
+}
+
+// CheckSize is the size in bytes of the check type in the flags.
+func (flags *StreamFlags) CheckSize() int {
+	return flags.getCheckSize()
+}
+
+// CheckName is the name xz uses for the check type in the flags.
+func (flags *StreamFlags) CheckName() string {
+	switch flags[1] & 0xF {
+	case 0x0:
+		return "None"
+	case 0x1:
+		return "CRC32"
+	case 0x4:
+		return "CRC64"
+	case 0xA:
+		return "SHA-256"
+	}
+	return fmt.Sprintf("Unknown-%d", flags[1]&0xF)
+}
@@ -0,0 +1,62 @@
+package xz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadInfo(t *testing.T) {
+	// test2.txt.multistream.xz was made by xz-utils, xz -lv shows the same
+	// offsets
+	buf, err := ioutil.ReadFile("../test/test2.txt.multistream.xz")
+	assert.Nil(t, err)
+
+	streams, err := ReadInfo(bytes.NewReader(buf), int64(len(buf)), true)
+	assert.Nil(t, err)
+	assert.Equal(t, len(streams), 2, "number of Streams")
+
+	assert.Equal(t, streams[0].Offset, int64(0), "first Stream offset")
+	assert.Equal(t, streams[0].CompressedSize(), int64(30676), "first Stream size")
+	assert.Equal(t, streams[0].UncompressedSize(), int64(100000), "first Stream uncompressed size")
+	assert.Equal(t, streams[0].Padding, int64(8), "first Stream padding")
+	assert.Equal(t, streams[0].Header.Flags.CheckName(), "SHA-256", "first Stream check")
+
+	assert.Equal(t, streams[1].Offset, int64(30684), "second Stream offset")
+	assert.Equal(t, streams[1].UncompressedOffset, int64(100000), "second Stream uncompressed offset")
+	assert.Equal(t, streams[1].Header.Flags.CheckName(), "CRC64", "second Stream check")
+
+	b := streams[1].Blocks[0]
+	assert.Equal(t, b.Offset, int64(30696), "Block offset")
+	assert.Equal(t, b.TotalSize(), int64(64300), "Block total size")
+	assert.Equal(t, b.HeaderSize(), 16, "Block Header size")
+	assert.Equal(t, b.CompressedSize(streams[1].Header.Flags), int64(64274), "Block compressed size")
+	check, err := b.ReadCheck(bytes.NewReader(buf), streams[1].Header.Flags)
+	assert.Nil(t, err)
+	assert.Equal(t, check, []byte{0xda, 0x42, 0x0c, 0x60, 0x13, 0xf3, 0x43, 0xb9}, "Block check")
+}
+
+func TestReadInfoErrors(t *testing.T) {
+	buf, err := ioutil.ReadFile("../test/test1.txt.xz")
+	assert.Nil(t, err)
+
+	_, err = ReadInfo(bytes.NewReader(buf[:len(buf)-1]), int64(len(buf)-1), false)
+	assert.Equal(t, err, errFileSize, "size not a multiple of four")
+
+	padded := append([]byte{0, 0, 0, 0}, buf...)
+	_, err = ReadInfo(bytes.NewReader(padded), int64(len(padded)), false)
+	assert.Equal(t, err, errBadHeaderMagic, "padding before the first Stream")
+
+	changed := append([]byte(nil), buf...)
+	changed[len(changed)-3] = 0x01
+	_, err = ReadInfo(bytes.NewReader(changed), int64(len(changed)), false)
+	assert.Equal(t, err, errBadStreamFooterCRC, "damaged Stream Footer")
+
+	// an Index whose Unpadded Sizes wrap around to the size of the Block
+	corrupt, err := ioutil.ReadFile("../test/corrupt_index.xz")
+	assert.Nil(t, err)
+	_, err = ReadInfo(bytes.NewReader(corrupt), int64(len(corrupt)), false)
+	assert.Equal(t, err, errIndexTooLarge, "Block sizes that overflow")
+}
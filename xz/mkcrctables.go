@@ -0,0 +1,92 @@
+//go:build ignore
+// +build ignore
+
+// mkcrctables writes the CRC32 and CRC64 lookup tables used by crc.go.
+// Run it with go generate.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+)
+
+const (
+	poly32 uint32 = 0xEDB88320
+	poly64 uint64 = 0xC96C5795D7870F42
+
+	// slices is the number of bytes Crc32 and Crc64 handle per step.
+	slices = 8
+)
+
+func main() {
+	output := flag.String("output", "crc_tables.go", "file to write the tables to")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "// Code generated by mkcrctables.go; DO NOT EDIT.")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "package xz")
+
+	var tables32 [slices][256]uint64
+	var tables64 [slices][256]uint64
+	for i := 0; i < 256; i++ {
+		crc32, crc64 := uint32(i), uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc32&1 != 0 {
+				crc32 = (crc32 >> 1) ^ poly32
+			} else {
+				crc32 = crc32 >> 1
+			}
+			if crc64&1 != 0 {
+				crc64 = (crc64 >> 1) ^ poly64
+			} else {
+				crc64 = crc64 >> 1
+			}
+		}
+		tables32[0][i] = uint64(crc32)
+		tables64[0][i] = crc64
+	}
+	for k := 1; k < slices; k++ {
+		for i := 0; i < 256; i++ {
+			prev := tables32[k-1][i]
+			tables32[k][i] = tables32[0][prev&0xFF] ^ (prev >> 8)
+			prev = tables64[k-1][i]
+			tables64[k][i] = tables64[0][prev&0xFF] ^ (prev >> 8)
+		}
+	}
+
+	writeTables(&buf, "crc32SlicingTables", "CRC32Table", "0x%08x,", tables32)
+	writeTables(&buf, "crc64SlicingTables", "CRC64Table", "0x%016x,", tables64)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ioutil.WriteFile(*output, src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeTables(buf *bytes.Buffer, name, typ, valueFormat string, tables [slices][256]uint64) {
+	fmt.Fprintf(buf, "\n// %s[k] holds the CRC of each byte followed by k zero\n", name)
+	fmt.Fprint(buf, "// bytes, the first table is the usual lookup table.\n")
+	fmt.Fprintf(buf, "var %s = [%d]%s{\n", name, slices, typ)
+	for _, table := range tables {
+		fmt.Fprint(buf, "{\n")
+		for i, v := range table {
+			fmt.Fprintf(buf, valueFormat, v)
+			if i%8 == 7 {
+				fmt.Fprint(buf, "\n")
+			} else {
+				fmt.Fprint(buf, " ")
+			}
+		}
+		fmt.Fprint(buf, "},\n")
+	}
+	fmt.Fprint(buf, "}\n")
+}
@@ -20,14 +20,17 @@ func (result *MultiByteInteger) Read(r io.Reader) error {
 	buf := make([]byte, 9)
 	i := 0
 	for {
+		if i == len(buf) {
+			return errMultiByteTooLong
+		}
 		var oneByte [1]byte
 		numRead, err := r.Read(oneByte[:])
 		if numRead != 1 {
+			if err != nil {
+				return err
+			}
 			return errNothingRead
 		}
-		if err != nil {
-			return err
-		}
 		buf[i] = oneByte[0]
 
 		if oneByte[0]&0x80 == 0 {
@@ -38,6 +41,15 @@ func (result *MultiByteInteger) Read(r io.Reader) error {
 	return result.Decode(buf)
 }
 
+func (source *MultiByteInteger) Write(w io.Writer) error {
+	buf, err := source.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
 func (result *MultiByteInteger) Decode(buf []byte) error {
 	var tmp uint64
 	if len(buf) == 0 {
@@ -80,3 +92,34 @@ func (source *MultiByteInteger) Encode() ([]byte, error) {
 	buf[i] = byte(num)
 	return buf[:(i + 1)], nil
 }
+
+// size is the number of bytes Encode uses for the number.
+func (source *MultiByteInteger) size() int {
+	size := 1
+	for num := uint64(*source); num >= 0x80; num >>= 7 {
+		size++
+	}
+	return size
+}
+
+// multiByteDecoder decodes a MultiByteInteger a byte at a time, for input
+// that arrives in pieces.
+type multiByteDecoder struct {
+	buf [9]byte
+	n   int
+}
+
+// push adds the next byte, done is set once the integer is complete.
+func (d *multiByteDecoder) push(b byte) (value MultiByteInteger, done bool, err error) {
+	if d.n == len(d.buf) {
+		return 0, false, errMultiByteTooLong
+	}
+	d.buf[d.n] = b
+	d.n++
+	if b&0x80 != 0 {
+		return 0, false, nil
+	}
+	err = value.Decode(d.buf[:d.n])
+	d.n = 0
+	return value, true, err
+}
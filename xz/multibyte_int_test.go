@@ -63,6 +63,30 @@ func TestIntTooLong(t *testing.T) {
 	assert.Equal(t, err, errMultiByteTooLong, "input too long should be rejected")
 }
 
+func TestMultiByteDecoder(t *testing.T) {
+	var d multiByteDecoder
+	for i, b := range []byte{0x81, 0x82, 0x83} {
+		_, done, err := d.push(b)
+		assert.Nil(t, err)
+		assert.False(t, done, "byte %d has the continuation bit set", i)
+	}
+	value, done, err := d.push(0x00)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.Equal(t, uint64(value), uint64(49409), "pushed bytes should decode like Decode")
+
+	value, done, err = d.push(0x0F)
+	assert.True(t, done)
+	assert.Equal(t, uint64(value), uint64(15), "the decoder should start over after a value")
+
+	for i := 0; i < 9; i++ {
+		_, _, err = d.push(0xF1)
+		assert.Nil(t, err)
+	}
+	_, _, err = d.push(0x0A)
+	assert.Equal(t, err, errMultiByteTooLong, "input too long should be rejected")
+}
+
 func TestEncodeSingleByte(t *testing.T) {
 	var multibyteInt = MultiByteInteger(15)
 
@@ -0,0 +1,39 @@
+package xz
+
+import (
+	"io"
+)
+
+// Progress counts the data that has passed through a Reader or Writer.
+type Progress struct {
+	Compressed   int64
+	Uncompressed int64
+}
+
+// ProgressFunc is called with the totals so far as data is read or written.
+// It is called often, so it should return quickly.
+type ProgressFunc func(Progress)
+
+// writeCounter counts the bytes written to w.
+type writeCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readCounter counts the bytes read from r.
+type readCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
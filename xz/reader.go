@@ -0,0 +1,172 @@
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+var errStreamPadding = errors.New("Stream padding is not a multiple of four null bytes")
+
+// Reader decompresses xz data. Concatenated Streams, optionally separated by
+// Stream Padding, are read as one.
+//
+// The filters used by each Block are looked up with NewFilter, so the
+// filters package has to be imported for the standard filters to be found.
+type Reader struct {
+	br     *bufio.Reader
+	in     *readCounter
+	config ReaderConfig
+	header StreamHeader
+	block  *blockReader
+	err    error
+
+	uncompressed int64
+
+	// records of the Blocks read so far, to compare with the Index
+	records []IndexRecord
+}
+
+// ReaderConfig configures a Reader.
+type ReaderConfig struct {
+	// Progress, if set, is called after every Read.
+	Progress ProgressFunc
+
+	// Context, if set, stops the Reader once it is done, Read then returns
+	// a CanceledError.
+	Context context.Context
+}
+
+// NewReader creates a Reader of the xz data in r and reads the first Stream
+// Header. The Reader may read more from r than the xz data itself.
+func NewReader(r io.Reader) (*Reader, error) {
+	return NewReaderConfig(r, ReaderConfig{})
+}
+
+// NewReaderConfig is NewReader with a config.
+func NewReaderConfig(r io.Reader, config ReaderConfig) (*Reader, error) {
+	in := &readCounter{r: r}
+	z := &Reader{br: bufio.NewReader(in), in: in, config: config}
+	err := z.header.read(z.br)
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Reset discards the Reader's state and reads the first Stream Header of r,
+// keeping the config and reusing the Reader's buffers.
+func (z *Reader) Reset(r io.Reader) error {
+	*z.in = readCounter{r: r}
+	z.br.Reset(z.in)
+	z.header = StreamHeader{}
+	z.block = nil
+	z.records = z.records[:0]
+	z.uncompressed = 0
+	z.err = z.header.read(z.br)
+	return z.err
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	if z.err == nil {
+		z.err = checkContext(z.config.Context, z.progress())
+	}
+	n, err := z.read(p)
+	z.uncompressed += int64(n)
+	if z.config.Progress != nil {
+		z.config.Progress(z.progress())
+	}
+	return n, err
+}
+
+// progress counts the compressed data the Reader has used, not what it has
+// buffered ahead.
+func (z *Reader) progress() Progress {
+	return Progress{
+		Compressed:   z.in.n - int64(z.br.Buffered()),
+		Uncompressed: z.uncompressed,
+	}
+}
+
+func (z *Reader) read(p []byte) (int, error) {
+	for z.err == nil {
+		if z.block == nil {
+			z.err = z.nextBlock()
+			continue
+		}
+
+		n, err := z.block.Read(p)
+		if err == io.EOF {
+			z.records = append(z.records, z.block.record())
+			z.block = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			z.err = err
+			return n, err
+		}
+	}
+	return 0, z.err
+}
+
+// nextBlock starts reading the next Block, or if the Index is next, reads the
+// rest of the Stream and moves on to the next one.
+func (z *Reader) nextBlock() error {
+	indicator, err := z.br.Peek(1)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if IndexIndicator(indicator[0]) != indexIndicator {
+		z.block, err = newBlockReader(z.br, z.header.Flags, new(Block))
+		return err
+	}
+
+	var index Index
+	err = index.read(z.br)
+	if err != nil {
+		return err
+	}
+	err = index.validate(z.records)
+	if err != nil {
+		return err
+	}
+	var footer StreamFooter
+	err = footer.read(z.br)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	err = footer.validate(&z.header, &index)
+	if err != nil {
+		return err
+	}
+	return z.nextStream()
+}
+
+// nextStream skips Stream Padding and reads the next Stream Header, returning
+// io.EOF if there is none.
+func (z *Reader) nextStream() error {
+	var null [4]byte
+	for {
+		padding, err := z.br.Peek(len(null))
+		if len(padding) == 0 && err == io.EOF {
+			return io.EOF
+		}
+		if err != nil {
+			if err == io.EOF {
+				return errStreamPadding
+			}
+			return err
+		}
+		if !bytes.Equal(padding, null[:]) {
+			break
+		}
+		z.br.Discard(len(null))
+	}
+
+	z.header = StreamHeader{}
+	z.records = nil
+	return unexpectedEOF(z.header.read(z.br))
+}
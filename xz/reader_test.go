@@ -0,0 +1,83 @@
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderBlockCheck(t *testing.T) {
+	chain := FilterChain{xorFilter{testFilterID, 0x0F}}
+	input := []byte("the check is computed while the block is decoded")
+
+	var compressed bytes.Buffer
+	w, err := NewWriter(&compressed, WriterConfig{Filters: chain})
+	assert.Nil(t, err)
+	_, err = w.Write(input)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	// the CRC64 is the last thing in the Block, just before the Index
+	buf := compressed.Bytes()
+	var stream Stream
+	err = stream.ReadStream(bufio.NewReader(bytes.NewReader(buf)))
+	assert.Nil(t, err)
+	checkOffset := 12 + stream.Blocks[0].Header.getRealSize() + len(input) + len(stream.Blocks[0].Padding)
+	buf[checkOffset] ^= 0x01
+
+	r, err := NewReader(bytes.NewReader(buf))
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, err, errBlockCheck, "a wrong check should be reported")
+}
+
+func TestReaderIntegrity(t *testing.T) {
+	chain := FilterChain{xorFilter{testFilterID, 0x0F}}
+	var compressed bytes.Buffer
+	w, err := NewWriter(&compressed, WriterConfig{Filters: chain})
+	assert.Nil(t, err)
+	_, err = w.Write([]byte("every part of the Stream is verified"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	size := compressed.Len()
+
+	tests := []struct {
+		name   string
+		offset int
+		err    error
+	}{
+		{"Stream Header flags", 7, errBadStreamHeaderCRC},
+		{"Block Header", 13, errBadBlockHeaderCRC},
+		{"Index", size - 14, errBadIndexCRC},
+		{"Stream Footer CRC", size - 12, errBadStreamFooterCRC},
+		{"Backward Size", size - 8, errBadStreamFooterCRC},
+	}
+	for _, tt := range tests {
+		buf := append([]byte(nil), compressed.Bytes()...)
+		buf[tt.offset] ^= 0x01
+		r, err := NewReader(bytes.NewReader(buf))
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+		assert.Equal(t, err, tt.err, tt.name)
+	}
+}
+
+func TestIndexValidate(t *testing.T) {
+	index := Index{Records: []IndexRecord{{20, 10}, {24, 16}}}
+	assert.Nil(t, index.validate([]IndexRecord{{20, 10}, {24, 16}}))
+	assert.Equal(t, index.validate([]IndexRecord{{20, 10}}), errIndexRecords, "missing Block")
+	assert.Equal(t, index.validate([]IndexRecord{{20, 10}, {24, 17}}), errIndexRecords, "wrong size")
+
+	// indicator, count, 2 records, 2 bytes of padding and the CRC32
+	assert.Equal(t, index.size(), 12, "Index size")
+	footer := StreamFooter{BackwardSize: 2}
+	assert.Nil(t, footer.validate(&StreamHeader{}, &index))
+	footer.BackwardSize = 3
+	assert.Equal(t, footer.validate(&StreamHeader{}, &index), errIndexSize, "Backward Size")
+	footer.Flags = StreamFlags{0x00, 0x04}
+	assert.Equal(t, footer.validate(&StreamHeader{}, &index), errStreamFlagsMismatch, "flags")
+}
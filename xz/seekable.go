@@ -0,0 +1,278 @@
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+var errSeekWhence = errors.New("Invalid whence for Seek")
+var errSeekNegative = errors.New("Seek to a negative offset")
+
+const (
+	// defaultCacheBlocks is how many decoded Blocks a SeekableReader keeps.
+	defaultCacheBlocks = 4
+	// maxCachedBlockSize is the largest Block that is decoded whole and
+	// cached, larger ones are decoded from their start up to the data read.
+	maxCachedBlockSize = 8 * MegaByte
+)
+
+// SeekableReader reads the uncompressed data of an xz file at any offset. The
+// Index of each Stream is read up front, and only the Blocks holding the data
+// asked for are decoded. The most recently used Blocks are kept decoded, unless
+// they are larger than maxCachedBlockSize. Those are decoded up to the end of
+// each read, and the decoder is kept so that the next read can go on from
+// there.
+//
+// ReadAt may be called concurrently, Read and Seek share an offset and may
+// not.
+type SeekableReader struct {
+	ra     io.ReaderAt
+	blocks []seekableBlock
+	size   int64
+	offset int64
+
+	mu       sync.Mutex
+	capacity int
+	lru      *list.List
+	cached   map[int]*list.Element
+	cursor   *blockCursor
+}
+
+// seekableBlock is a Block and the Stream it is in.
+type seekableBlock struct {
+	BlockInfo
+	flags  StreamFlags
+	record IndexRecord
+}
+
+type cachedBlock struct {
+	index int
+	data  []byte
+}
+
+// blockCursor is a decoder part way through a Block too large to cache.
+type blockCursor struct {
+	index int
+	r     *blockReader
+	pos   int64
+}
+
+// NewSeekableReader creates a SeekableReader of the xz file in ra, which is
+// size bytes long.
+func NewSeekableReader(ra io.ReaderAt, size int64) (*SeekableReader, error) {
+	streams, err := ReadInfo(ra, size, false)
+	if err != nil {
+		return nil, err
+	}
+
+	z := &SeekableReader{
+		ra:       ra,
+		capacity: defaultCacheBlocks,
+		lru:      list.New(),
+		cached:   make(map[int]*list.Element),
+	}
+	for _, s := range streams {
+		for i, b := range s.Blocks {
+			z.blocks = append(z.blocks, seekableBlock{b, s.Header.Flags, s.Index.Records[i]})
+		}
+		z.size += s.UncompressedSize()
+	}
+	return z, nil
+}
+
+// Size is the size of the uncompressed data.
+func (z *SeekableReader) Size() int64 {
+	return z.size
+}
+
+// SetCacheSize sets how many decoded Blocks are kept, at least one is.
+func (z *SeekableReader) SetCacheSize(blocks int) {
+	if blocks < 1 {
+		blocks = 1
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.capacity = blocks
+	z.evict()
+}
+
+func (z *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errSeekNegative
+	}
+	n := 0
+	for n < len(p) {
+		if off >= z.size {
+			return n, io.EOF
+		}
+		i := z.find(off)
+		var copied int
+		var err error
+		if z.blocks[i].UncompressedSize > maxCachedBlockSize {
+			copied, err = z.readLarge(i, p[n:], off-z.blocks[i].UncompressedOffset)
+		} else {
+			var data []byte
+			data, err = z.block(i)
+			if err == nil {
+				copied = copy(p[n:], data[off-z.blocks[i].UncompressedOffset:])
+			}
+		}
+		if err != nil {
+			return n, err
+		}
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+func (z *SeekableReader) Read(p []byte) (int, error) {
+	n, err := z.ReadAt(p, z.offset)
+	z.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (z *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += z.offset
+	case io.SeekEnd:
+		offset += z.size
+	default:
+		return 0, errSeekWhence
+	}
+	if offset < 0 {
+		return 0, errSeekNegative
+	}
+	z.offset = offset
+	return offset, nil
+}
+
+// find returns the index of the Block holding the uncompressed byte at off,
+// which has to be before the end of the data.
+func (z *SeekableReader) find(off int64) int {
+	return sort.Search(len(z.blocks), func(i int) bool {
+		b := &z.blocks[i]
+		return b.UncompressedOffset+b.UncompressedSize > off
+	})
+}
+
+// block returns the decoded data of Block i, from the cache if it is there.
+func (z *SeekableReader) block(i int) ([]byte, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if e, ok := z.cached[i]; ok {
+		z.lru.MoveToFront(e)
+		return e.Value.(*cachedBlock).data, nil
+	}
+
+	data, err := z.decode(&z.blocks[i])
+	if err != nil {
+		return nil, err
+	}
+	z.cached[i] = z.lru.PushFront(&cachedBlock{index: i, data: data})
+	z.evict()
+	return data, nil
+}
+
+func (z *SeekableReader) evict() {
+	for z.lru.Len() > z.capacity {
+		e := z.lru.Back()
+		z.lru.Remove(e)
+		delete(z.cached, e.Value.(*cachedBlock).index)
+	}
+}
+
+// readLarge reads from off in Block i, which is too large to cache. The
+// decoder left by the last read is used if it has not gone past off.
+func (z *SeekableReader) readLarge(i int, p []byte, off int64) (int, error) {
+	z.mu.Lock()
+	c := z.cursor
+	z.cursor = nil
+	z.mu.Unlock()
+	if c == nil || c.index != i || c.pos > off {
+		r, err := z.open(&z.blocks[i])
+		if err != nil {
+			return 0, err
+		}
+		c = &blockCursor{index: i, r: r}
+	}
+
+	b := &z.blocks[i]
+	skipped, err := io.CopyN(ioutil.Discard, c.r, off-c.pos)
+	c.pos += skipped
+	if err != nil {
+		return 0, blockTooShort(err)
+	}
+	if rest := b.UncompressedSize - off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := io.ReadFull(c.r, p)
+	c.pos += int64(n)
+	if err != nil {
+		return n, blockTooShort(err)
+	}
+
+	if c.pos < b.UncompressedSize {
+		z.mu.Lock()
+		z.cursor = c
+		z.mu.Unlock()
+		return n, nil
+	}
+	// the whole Block has been read, it has to end here
+	extra, err := io.Copy(ioutil.Discard, io.LimitReader(c.r, 1))
+	if err != nil {
+		return n, err
+	}
+	if extra != 0 || c.r.record() != b.record {
+		return n, errIndexRecords
+	}
+	return n, nil
+}
+
+// blockTooShort is the error for a Block that ended before the size in its
+// Index Record.
+func blockTooShort(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errIndexRecords
+	}
+	return err
+}
+
+func (z *SeekableReader) open(b *seekableBlock) (*blockReader, error) {
+	br := bufio.NewReader(io.NewSectionReader(z.ra, b.Offset, b.TotalSize()))
+	r, err := newBlockReader(br, b.flags, new(Block))
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return r, nil
+}
+
+// decode decodes a Block and checks it against its Index Record.
+func (z *SeekableReader) decode(b *seekableBlock) ([]byte, error) {
+	r, err := z.open(b)
+	if err != nil {
+		return nil, err
+	}
+	// the size in the Index is not trusted until the Block has been decoded,
+	// so it is only used to stop reading one byte past it
+	var data bytes.Buffer
+	_, err = data.ReadFrom(io.LimitReader(r, b.UncompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(data.Len()) != b.UncompressedSize || r.record() != b.record {
+		return nil, errIndexRecords
+	}
+	return data.Bytes(), nil
+}
@@ -0,0 +1,162 @@
+package xz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// seekableInput is two Streams of several Blocks each.
+func seekableInput(t *testing.T) ([]byte, []byte) {
+	chain := FilterChain{xorFilter{testFilterID, 0x5A}}
+	var input, compressed bytes.Buffer
+	for stream := 0; stream < 2; stream++ {
+		w, err := NewWriter(&compressed, WriterConfig{Filters: chain, BlockSize: 100})
+		assert.Nil(t, err)
+		for i := 0; i < 250; i++ {
+			b := []byte{byte(stream), byte(i)}
+			input.Write(b)
+			_, err = w.Write(b)
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, w.Close())
+	}
+	return input.Bytes(), compressed.Bytes()
+}
+
+func TestSeekableReaderReadAt(t *testing.T) {
+	input, compressed := seekableInput(t)
+	z, err := NewSeekableReader(bytes.NewReader(compressed), int64(len(compressed)))
+	assert.Nil(t, err)
+	assert.Equal(t, z.Size(), int64(len(input)))
+	assert.Equal(t, len(z.blocks), 10, "each Stream should have 5 Blocks")
+	z.SetCacheSize(2)
+
+	tests := []struct {
+		off, n int64
+	}{
+		{0, 10},
+		{95, 10},   // across a Block
+		{490, 20},  // across a Stream
+		{999, 1},   // the last byte
+		{250, 300}, // across several Blocks
+		{0, 1000},
+	}
+	for _, tt := range tests {
+		p := make([]byte, tt.n)
+		n, err := z.ReadAt(p, tt.off)
+		assert.Nil(t, err, "offset %d", tt.off)
+		assert.Equal(t, n, int(tt.n), "offset %d", tt.off)
+		assert.Equal(t, p, input[tt.off:tt.off+tt.n], "offset %d", tt.off)
+		assert.True(t, z.lru.Len() <= 2, "the cache should be limited")
+	}
+
+	p := make([]byte, 10)
+	n, err := z.ReadAt(p, 995)
+	assert.Equal(t, err, io.EOF, "reading past the end")
+	assert.Equal(t, n, 5)
+	_, err = z.ReadAt(p, -1)
+	assert.Equal(t, err, errSeekNegative)
+}
+
+func TestSeekableReaderSeek(t *testing.T) {
+	input, compressed := seekableInput(t)
+	z, err := NewSeekableReader(bytes.NewReader(compressed), int64(len(compressed)))
+	assert.Nil(t, err)
+
+	all, err := ioutil.ReadAll(z)
+	assert.Nil(t, err)
+	assert.Equal(t, all, input, "reading from the start")
+
+	off, err := z.Seek(-10, io.SeekEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, off, int64(990))
+	off, err = z.Seek(-500, io.SeekCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, off, int64(490))
+	rest, err := ioutil.ReadAll(z)
+	assert.Nil(t, err)
+	assert.Equal(t, rest, input[490:])
+
+	_, err = z.Seek(-1, io.SeekStart)
+	assert.Equal(t, err, errSeekNegative)
+	_, err = z.Seek(0, 3)
+	assert.Equal(t, err, errSeekWhence)
+}
+
+func TestSeekableReaderCorrupt(t *testing.T) {
+	_, compressed := seekableInput(t)
+	// the first byte of the first Block's data
+	compressed[12+12] ^= 0xFF
+	z, err := NewSeekableReader(bytes.NewReader(compressed), int64(len(compressed)))
+	assert.Nil(t, err, "the Index is intact")
+
+	_, err = z.ReadAt(make([]byte, 10), 500)
+	assert.Nil(t, err, "other Blocks can still be read")
+	_, err = z.ReadAt(make([]byte, 10), 0)
+	assert.NotNil(t, err, "the corrupt Block should fail")
+}
+
+func TestSeekableReaderIndexTooLarge(t *testing.T) {
+	var compressed bytes.Buffer
+	w, err := NewWriter(&compressed, WriterConfig{Filters: FilterChain{xorFilter{testFilterID, 0x5A}}})
+	assert.Nil(t, err)
+	_, err = w.Write([]byte("small"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	streams, err := ReadInfo(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()), false)
+	assert.Nil(t, err)
+
+	// the Index claims the Block holds 1 TiB
+	s := streams[0]
+	s.Index.Records[0].UncompressedSize = 1 << 40
+	var crafted bytes.Buffer
+	crafted.Write(compressed.Bytes()[:streamHeaderSize+s.blocksSize()])
+	assert.Nil(t, s.Index.write(&crafted))
+	s.Footer.BackwardSize = BackwardSize(s.Index.size()/4 - 1)
+	assert.Nil(t, s.Footer.write(&crafted))
+
+	z, err := NewSeekableReader(bytes.NewReader(crafted.Bytes()), int64(crafted.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, z.Size(), int64(1<<40))
+	_, err = z.ReadAt(make([]byte, 10), 0)
+	assert.Equal(t, err, errIndexRecords, "the Block is smaller than the Index says")
+}
+
+func TestSeekableReaderLargeBlock(t *testing.T) {
+	size := 3 * maxCachedBlockSize
+	input := make([]byte, size)
+	for i := range input {
+		input[i] = byte(i / 1000)
+	}
+	var compressed bytes.Buffer
+	w, err := NewWriter(&compressed, WriterConfig{Filters: FilterChain{xorFilter{testFilterID, 0x5A}}, BlockSize: int64(size)})
+	assert.Nil(t, err)
+	_, err = w.Write(input)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	z, err := NewSeekableReader(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, len(z.blocks), 1)
+
+	// the Block is decoded up to the data read, not into memory
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	p := make([]byte, 100)
+	n, err := z.ReadAt(p, int64(size-100))
+	runtime.ReadMemStats(&after)
+	assert.Nil(t, err)
+	assert.Equal(t, n, 100)
+	assert.Equal(t, p, input[size-100:])
+	assert.True(t, after.TotalAlloc-before.TotalAlloc < MegaByte, "allocated %d bytes", after.TotalAlloc-before.TotalAlloc)
+	assert.Equal(t, z.lru.Len(), 0, "the Block should not be cached")
+
+	all, err := ioutil.ReadAll(z)
+	assert.Nil(t, err)
+	assert.Equal(t, all, input, "reading on from the last read")
+}
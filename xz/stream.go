@@ -5,6 +5,7 @@ package xz
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -14,6 +15,10 @@ var errBadHeaderMagic = errors.New("Stream header has bad magic number")
 var errBadFooterMagic = errors.New("Stream footer has bad magic number")
 var errBadStreamFlags = errors.New("Stream flags first byte is not 0x00")
 var errReservedFlagsUsed = errors.New("Reserved Stream Flags in use")
+var errBadStreamHeaderCRC = errors.New("Stream header CRC32 does not match")
+var errBadStreamFooterCRC = errors.New("Stream footer CRC32 does not match")
+var errStreamFlagsMismatch = errors.New("Stream Header and Stream Footer flags do not match")
+var errIndexSize = errors.New("Index does not match the Backward Size in the Stream Footer")
 
 type Stream struct {
 	Header  StreamHeader
@@ -33,6 +38,14 @@ type StreamFooterMagic [2]byte
 var streamHeaderMagic = StreamHeaderMagic{0xFD, '7', 'z', 'X', 'Z', 0x00}
 var streamFooterMagic = StreamFooterMagic{'Y', 'Z'}
 
+// MagicSize is the number of bytes IsXZ needs to recognise xz data.
+const MagicSize = len(streamHeaderMagic)
+
+// IsXZ reports whether b starts with the magic bytes of a Stream Header.
+func IsXZ(b []byte) bool {
+	return bytes.HasPrefix(b, streamHeaderMagic[:])
+}
+
 type checkType string
 
 const (
@@ -102,11 +115,14 @@ func (stream *Stream) ReadStream(br *bufio.Reader) error {
 
 func (s *Stream) readBlockOrIndex(br *bufio.Reader) (streamContainerType, error) {
 	indicatorOrSize, err := br.Peek(1)
+	if err != nil {
+		return isNone, unexpectedEOF(err)
+	}
 	if IndexIndicator(indicatorOrSize[0]) == indexIndicator {
 		return isIndex, s.Index.read(br)
 	} else {
 		b := new(Block)
-		err = b.read(br)
+		err = b.read(br, s.Header.Flags)
 		if err != nil {
 			return isNone, err
 		}
@@ -116,19 +132,39 @@ func (s *Stream) readBlockOrIndex(br *bufio.Reader) (streamContainerType, error)
 }
 
 func (s *Stream) validate() error {
-	return nil
+	records := make([]IndexRecord, len(s.Blocks))
+	for i, b := range s.Blocks {
+		records[i] = b.record
+	}
+	err := s.Index.validate(records)
+	if err != nil {
+		return err
+	}
+	return s.Footer.validate(&s.Header, &s.Index)
 }
 
-func (s *Stream) readPadding(r io.Reader) error {
+// readPadding reads the Stream Padding up to the end of the input or the
+// next Stream.
+func (s *Stream) readPadding(br *bufio.Reader) error {
 	for {
-		p := new(StreamPadding)
-		err := p.read(r)
+		next, err := br.Peek(len(StreamPadding{}))
+		if len(next) == 0 && err == io.EOF {
+			break
+		}
 		if err != nil {
 			if err == io.EOF {
-				break
+				return errStreamPadding
 			}
 			return err
 		}
+		if !bytes.Equal(next, make([]byte, len(next))) {
+			break
+		}
+		p := new(StreamPadding)
+		err = p.read(br)
+		if err != nil {
+			return err
+		}
 		s.Padding = append(s.Padding, p)
 	}
 	return nil
@@ -151,17 +187,20 @@ func (header *StreamHeader) read(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	err = binary.Read(r, binary.LittleEndian, &header.CRC)
+	if err != nil {
+		return err
+	}
+	if CRC32(Crc32(header.Flags[:], len(header.Flags), 0)) != header.CRC {
+		return errBadStreamHeaderCRC
+	}
+
 	if header.Flags[0] != 0x00 {
 		return errBadStreamFlags
 	}
 	if header.Flags[1]&0xF0 != 0x0 {
 		return errReservedFlagsUsed
 	}
-
-	err = binary.Read(r, binary.LittleEndian, &header.CRC)
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
@@ -180,6 +219,12 @@ func (footer *StreamFooter) read(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	var crc [6]byte
+	binary.LittleEndian.PutUint32(crc[:], uint32(footer.BackwardSize))
+	copy(crc[4:], footer.Flags[:])
+	if CRC32(Crc32(crc[:], len(crc), 0)) != footer.CRC {
+		return errBadStreamFooterCRC
+	}
 	if footer.Flags[0] != 0x00 {
 		return errBadStreamFlags
 	}
@@ -197,6 +242,54 @@ func (footer *StreamFooter) read(r io.Reader) error {
 	return nil
 }
 
+// write stores the Stream Header, filling in its Magic and CRC.
+func (header *StreamHeader) write(w io.Writer) error {
+	header.Magic = streamHeaderMagic
+	header.CRC = CRC32(Crc32(header.Flags[:], len(header.Flags), 0))
+
+	var buf bytes.Buffer
+	buf.Write(header.Magic[:])
+	buf.Write(header.Flags[:])
+	binary.Write(&buf, binary.LittleEndian, header.CRC)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// write stores the Stream Footer, filling in its Magic and CRC.
+func (footer *StreamFooter) write(w io.Writer) error {
+	footer.Magic = streamFooterMagic
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, footer.BackwardSize)
+	buf.Write(footer.Flags[:])
+	footer.CRC = CRC32(Crc32(buf.Bytes(), buf.Len(), 0))
+
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], uint32(footer.CRC))
+	_, err := w.Write(crc[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(footer.Magic[:])
+	return err
+}
+
+// validate checks the Stream Footer against the Stream Header and the Index
+// before it.
+func (footer *StreamFooter) validate(header *StreamHeader, index *Index) error {
+	if footer.Flags != header.Flags {
+		return errStreamFlagsMismatch
+	}
+	if footer.BackwardSize.getRealSize() != index.size() {
+		return errIndexSize
+	}
+	return nil
+}
+
 func (b *BackwardSize) getRealSize() int {
 	return int((*b + 1) * 4)
 }
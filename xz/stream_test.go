@@ -1,6 +1,7 @@
 package xz
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"testing"
@@ -15,8 +16,8 @@ func TestReadStreamHeader(t *testing.T) {
 	flags := [...]byte{0x00, 0x1}
 	flagR := bytes.NewReader(flags[:])
 
-	crc := [...]byte{0x12, 0x13, 0x05, 0x72}
-	crcAsInt := CRC32(0x72051312)
+	crc := [...]byte{0x69, 0x22, 0xDE, 0x36}
+	crcAsInt := CRC32(0x36DE2269)
 	crcR := bytes.NewReader(crc[:])
 
 	r := io.MultiReader(magicR, flagR, crcR)
@@ -36,8 +37,8 @@ func TestReadStreamHeader(t *testing.T) {
 }
 
 func TestReadStreamFooter(t *testing.T) {
-	crc := [...]byte{0x12, 0x13, 0x05, 0x72}
-	crcAsInt := CRC32(0x72051312)
+	crc := [...]byte{0x90, 0x42, 0x99, 0x0D}
+	crcAsInt := CRC32(0x0D994290)
 	crcR := bytes.NewReader(crc[:])
 
 	bsize := [...]byte{0x01, 0x00, 0x00, 0x00}
@@ -67,7 +68,7 @@ func TestReadStreamFooter(t *testing.T) {
 
 func TestReadNoPadding(t *testing.T) {
 	padding := []byte{}
-	r := bytes.NewReader(padding)
+	r := bufio.NewReader(bytes.NewReader(padding))
 	var s Stream
 	err := s.readPadding(r)
 
@@ -79,10 +80,33 @@ func TestReadSomePadding(t *testing.T) {
 	padding := []byte{0x00, 0x00, 0x00, 0x00,
 		0x00, 0x00, 0x00, 0x00,
 		0x00, 0x00, 0x00, 0x00}
-	r := bytes.NewReader(padding)
+	r := bufio.NewReader(bytes.NewReader(padding))
 	var s Stream
 	err := s.readPadding(r)
 
 	assert.Nil(t, err)
 	assert.Equal(t, len(s.Padding), 3, "should have read 2 blocks of padding")
 }
+
+func TestReadPaddingBeforeStream(t *testing.T) {
+	input := append([]byte{0x00, 0x00, 0x00, 0x00}, streamHeaderMagic[:]...)
+	r := bufio.NewReader(bytes.NewReader(input))
+	var s Stream
+	err := s.readPadding(r)
+
+	assert.Nil(t, err)
+	assert.Equal(t, len(s.Padding), 1, "the next Stream is not padding")
+	next, _ := r.Peek(MagicSize)
+	assert.Equal(t, next, streamHeaderMagic[:], "the next Stream should be left unread")
+
+	r = bufio.NewReader(bytes.NewReader([]byte{0x00, 0x00}))
+	assert.Equal(t, s.readPadding(r), errStreamPadding, "padding must be a multiple of four bytes")
+}
+
+func TestIsXZ(t *testing.T) {
+	assert.True(t, IsXZ([]byte{0xFD, '7', 'z', 'X', 'Z', 0x00, 0x00, 0x04}))
+	assert.True(t, IsXZ(streamHeaderMagic[:MagicSize]))
+	assert.False(t, IsXZ([]byte{0xFD, '7', 'z', 'X', 'Z'}), "a truncated header is not xz")
+	assert.False(t, IsXZ([]byte("plain text")))
+	assert.False(t, IsXZ(nil))
+}
@@ -0,0 +1,383 @@
+package xz
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+var errWriterClosed = errors.New("Writer is already closed")
+var errBlockSize = errors.New("Block size can not be negative")
+
+// DefaultBlockSize is the Block size used if WriterConfig.BlockSize is 0.
+const DefaultBlockSize = 64 * MegaByte
+
+// WriterConfig controls how a Writer encodes data.
+type WriterConfig struct {
+	// Filters is the filter chain used for every Block, usually ending with
+	// LZMA2. It is recorded in the Filter Flags of each Block Header.
+	Filters FilterChain
+
+	// BlockSize is the most uncompressed data stored in one Block. Each
+	// Block is compressed in memory so its sizes can go in its header.
+	BlockSize int64
+
+	// SelectFilters, if set, picks the filter chain of each Block from its
+	// uncompressed data, which is then buffered until the Block is full.
+	// Filters is still used to validate the config.
+	SelectFilters func(block []byte) FilterChain
+
+	// Progress, if set, is called after every Write.
+	Progress ProgressFunc
+
+	// Context, if set, stops the Writer once it is done, Write and Close
+	// then return a CanceledError.
+	Context context.Context
+}
+
+// Writer compresses data into a single xz Stream.
+type Writer struct {
+	w      *writeCounter
+	config WriterConfig
+	flags  StreamFlags
+	index  Index
+	block  *blockWriter
+	err    error
+
+	// pending is the data of the current Block if SelectFilters is set.
+	pending []byte
+	// compressed holds the compressed data of the current Block.
+	compressed bytes.Buffer
+
+	uncompressed int64
+}
+
+// NewWriter creates a Writer that writes xz data to w, starting with the
+// Stream Header.
+func NewWriter(w io.Writer, config WriterConfig) (*Writer, error) {
+	err := config.Filters.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if config.BlockSize < 0 {
+		return nil, errBlockSize
+	}
+	if config.BlockSize == 0 {
+		config.BlockSize = DefaultBlockSize
+	}
+
+	z := &Writer{
+		w:      &writeCounter{w: w},
+		config: config,
+		flags:  StreamFlags{0x00, 0x04},
+	}
+	header := StreamHeader{Flags: z.flags}
+	err = header.write(z.w)
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Reset discards the Writer's state and starts a new Stream on w, keeping the
+// config and reusing the Writer's buffers.
+func (z *Writer) Reset(w io.Writer) error {
+	z.Abort()
+	*z.w = writeCounter{w: w}
+	z.index = Index{Records: z.index.Records[:0]}
+	z.uncompressed = 0
+	header := StreamHeader{Flags: z.flags}
+	z.err = header.write(z.w)
+	return z.err
+}
+
+// Abort gives back the buffers of the Block being compressed without writing
+// the rest of the Stream. Write and Close fail after it, until Reset. It does
+// nothing once the Writer is closed.
+func (z *Writer) Abort() {
+	if z.block != nil {
+		z.block.release()
+		z.block = nil
+	}
+	z.pending = z.pending[:0]
+	if z.err == nil {
+		z.err = errWriterClosed
+	}
+}
+
+func (z *Writer) Write(p []byte) (int, error) {
+	n := 0
+	for z.err == nil && n < len(p) {
+		z.err = checkContext(z.config.Context, z.progress())
+		if z.err != nil {
+			break
+		}
+		piece := p[n:]
+		if len(piece) > contextCheckSize {
+			piece = piece[:contextCheckSize]
+		}
+		var written int
+		if z.config.SelectFilters != nil {
+			written, z.err = z.writePending(piece)
+		} else {
+			written, z.err = z.write(piece)
+		}
+		n += written
+		z.uncompressed += int64(written)
+	}
+	if z.config.Progress != nil {
+		z.config.Progress(z.progress())
+	}
+	return n, z.err
+}
+
+// progress counts the compressed data of the current Block as soon as the
+// filters produce it, even though the Block is only written once complete.
+func (z *Writer) progress() Progress {
+	p := Progress{Compressed: z.w.n, Uncompressed: z.uncompressed}
+	if z.block != nil {
+		p.Compressed += int64(z.block.compressed.Len())
+	}
+	return p
+}
+
+func (z *Writer) write(p []byte) (int, error) {
+	n := 0
+	for z.err == nil && n < len(p) {
+		if z.block == nil {
+			z.block, z.err = newBlockWriter(z.config.Filters, z.flags, &z.compressed)
+			if z.err != nil {
+				break
+			}
+		}
+
+		chunk := p[n:]
+		if room := z.config.BlockSize - z.block.uncompressed; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		var written int
+		written, z.err = z.block.Write(chunk)
+		n += written
+
+		if z.err == nil && z.block.uncompressed == z.config.BlockSize {
+			z.err = z.flushBlock()
+		}
+	}
+	return n, z.err
+}
+
+func (z *Writer) writePending(p []byte) (int, error) {
+	n := 0
+	for z.err == nil && n < len(p) {
+		chunk := p[n:]
+		if room := z.config.BlockSize - int64(len(z.pending)); int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		z.pending = append(z.pending, chunk...)
+		n += len(chunk)
+
+		if int64(len(z.pending)) == z.config.BlockSize {
+			z.err = z.flushBlock()
+		}
+	}
+	return n, z.err
+}
+
+// startPending compresses the buffered data of the current Block with the
+// filter chain picked for it, checking the Context between pieces as Write
+// does.
+func (z *Writer) startPending() error {
+	filters := z.config.SelectFilters(z.pending)
+	err := filters.Validate()
+	if err != nil {
+		return err
+	}
+	z.block, err = newBlockWriter(filters, z.flags, &z.compressed)
+	if err != nil {
+		return err
+	}
+	for off := 0; off < len(z.pending) && err == nil; off += contextCheckSize {
+		err = checkContext(z.config.Context, z.progress())
+		if err != nil {
+			break
+		}
+		piece := z.pending[off:]
+		if len(piece) > contextCheckSize {
+			piece = piece[:contextCheckSize]
+		}
+		_, err = z.block.Write(piece)
+	}
+	z.pending = z.pending[:0]
+	return err
+}
+
+func (z *Writer) flushBlock() error {
+	if z.config.SelectFilters != nil {
+		err := z.startPending()
+		if err != nil {
+			return err
+		}
+	}
+	// a Block that fails is kept for Abort to release
+	record, err := z.block.finish(z.w)
+	if err != nil {
+		return err
+	}
+	z.block = nil
+	z.index.Records = append(z.index.Records, record)
+	return nil
+}
+
+// Close writes the last Block, the Index and the Stream Footer. It does not
+// close the underlying writer.
+func (z *Writer) Close() error {
+	if z.err == nil {
+		z.err = checkContext(z.config.Context, z.progress())
+	}
+	if z.err != nil {
+		return z.err
+	}
+	if z.block != nil || len(z.pending) > 0 {
+		z.err = z.flushBlock()
+	}
+	if z.err == nil {
+		z.err = z.writeIndex()
+	}
+	if z.err != nil {
+		return z.err
+	}
+	if z.config.Progress != nil {
+		z.config.Progress(z.progress())
+	}
+	z.err = errWriterClosed
+	return nil
+}
+
+func (z *Writer) writeIndex() error {
+	z.index.NumberOfRecords = MultiByteInteger(len(z.index.Records))
+	var buf bytes.Buffer
+	err := z.index.write(&buf)
+	if err != nil {
+		return err
+	}
+
+	footer := StreamFooter{
+		BackwardSize: BackwardSize(buf.Len()/4 - 1),
+		Flags:        z.flags,
+	}
+	err = footer.write(&buf)
+	if err != nil {
+		return err
+	}
+	_, err = z.w.Write(buf.Bytes())
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// blockWriter compresses the data of a single Block into memory.
+type blockWriter struct {
+	filters    FilterChain
+	compressed *bytes.Buffer
+
+	w io.WriteCloser
+	// writers are the writers of each filter, first to last
+	writers      []io.WriteCloser
+	uncompressed int64
+	check        Check
+}
+
+// newBlockWriter compresses into buf, which is emptied first.
+func newBlockWriter(filters FilterChain, flags StreamFlags, buf *bytes.Buffer) (*blockWriter, error) {
+	check, err := NewCheck(flags)
+	if err != nil {
+		return nil, err
+	}
+	buf.Reset()
+	err = filters.Validate()
+	if err != nil {
+		return nil, err
+	}
+	b := &blockWriter{filters: filters, compressed: buf, check: check}
+	b.writers = make([]io.WriteCloser, len(filters))
+	var w io.WriteCloser = nopWriteCloser{b.compressed}
+	for i := len(filters) - 1; i >= 0; i-- {
+		w, err = filters[i].NewWriter(w)
+		if err != nil {
+			b.release()
+			return nil, err
+		}
+		b.writers[i] = w
+	}
+	b.w = w
+	return b, nil
+}
+
+// release gives back the pooled buffers of filters that are not closed.
+func (b *blockWriter) release() {
+	for _, w := range b.writers {
+		if r, ok := w.(Releaser); ok {
+			r.Release()
+		}
+	}
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	n, err := b.w.Write(p)
+	b.check.Write(p[:n])
+	b.uncompressed += int64(n)
+	return n, err
+}
+
+// finish flushes the filters and writes the whole Block to w, returning its
+// Index Record.
+func (b *blockWriter) finish(w io.Writer) (IndexRecord, error) {
+	err := b.w.Close()
+	if err != nil {
+		return IndexRecord{}, err
+	}
+
+	filters := b.filters.Flags()
+	header := BlockHeader{
+		Flags:            byte(len(filters)-1) | blockFlagsCompressedSize | blockFlagsUncompressedSize,
+		CompressedSize:   MultiByteInteger(b.compressed.Len()),
+		UncompressedSize: MultiByteInteger(b.uncompressed),
+	}
+	copy(header.FilterFlags[:], filters)
+
+	var buf bytes.Buffer
+	err = header.write(&buf)
+	if err != nil {
+		return IndexRecord{}, err
+	}
+	unpaddedSize := buf.Len() + b.compressed.Len() + b.check.Size()
+	padding := (4 - b.compressed.Len()%4) % 4
+
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		return IndexRecord{}, err
+	}
+	_, err = b.compressed.WriteTo(w)
+	if err != nil {
+		return IndexRecord{}, err
+	}
+
+	buf.Write(make([]byte, padding))
+	buf.Write(b.check.Sum())
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		return IndexRecord{}, err
+	}
+
+	return IndexRecord{
+		UnpaddedSize:     MultiByteInteger(unpaddedSize),
+		UncompressedSize: MultiByteInteger(b.uncompressed),
+	}, nil
+}
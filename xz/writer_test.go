@@ -0,0 +1,176 @@
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	chain := FilterChain{xorFilter{testFilterID, 0x0F}, xorFilter{testFilterID, 0x33}}
+	input := bytes.Repeat([]byte("every block records its filter chain. "), 100)
+
+	var compressed bytes.Buffer
+	w, err := NewWriter(&compressed, WriterConfig{Filters: chain, BlockSize: 1000})
+	assert.Nil(t, err)
+	_, err = w.Write(input[:1500])
+	assert.Nil(t, err)
+	_, err = w.Write(input[1500:])
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	_, err = w.Write(input)
+	assert.Equal(t, err, errWriterClosed, "writing after Close should fail")
+
+	var stream Stream
+	err = stream.ReadStream(bufio.NewReader(bytes.NewReader(compressed.Bytes())))
+	assert.Nil(t, err)
+	assert.Equal(t, len(stream.Blocks), 4, "input should be split at the block size")
+	assert.Equal(t, int(stream.Index.NumberOfRecords), 4, "every block should have an index record")
+	for _, b := range stream.Blocks {
+		assert.Equal(t, b.Header.Filters(), chain.Flags(), "block headers should record the filter chain")
+	}
+	assert.Equal(t, int(stream.Blocks[3].Header.UncompressedSize), len(input)-3000)
+
+	r, err := NewReader(&compressed)
+	assert.Nil(t, err)
+	decoded, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, decoded, input, "decoding should undo encoding")
+}
+
+func TestNewWriterInvalidConfig(t *testing.T) {
+	_, err := NewWriter(ioutil.Discard, WriterConfig{})
+	assert.Equal(t, err, errEmptyFilterChain)
+
+	chain := FilterChain{xorFilter{testFilterID, 1}}
+	_, err = NewWriter(ioutil.Discard, WriterConfig{Filters: chain, BlockSize: -1})
+	assert.Equal(t, err, errBlockSize)
+}
+
+func TestWriterSelectFilters(t *testing.T) {
+	plain := FilterChain{xorFilter{testFilterID, 0x0F}}
+	double := FilterChain{xorFilter{testFilterID, 0xF0}, xorFilter{testFilterID, 0x0F}}
+	input := append(bytes.Repeat([]byte{'a'}, 1500), bytes.Repeat([]byte{'b'}, 1200)...)
+
+	var blocks [][]byte
+	config := WriterConfig{
+		Filters:   plain,
+		BlockSize: 1000,
+		SelectFilters: func(block []byte) FilterChain {
+			blocks = append(blocks, append([]byte(nil), block...))
+			if block[len(block)-1] == 'b' {
+				return double
+			}
+			return plain
+		},
+	}
+
+	var compressed bytes.Buffer
+	w, err := NewWriter(&compressed, config)
+	assert.Nil(t, err)
+	_, err = w.Write(input)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, blocks, [][]byte{input[:1000], input[1000:2000], input[2000:]}, "every block should be offered whole")
+
+	var stream Stream
+	err = stream.ReadStream(bufio.NewReader(bytes.NewReader(compressed.Bytes())))
+	assert.Nil(t, err)
+	assert.Equal(t, stream.Blocks[0].Header.Filters(), plain.Flags())
+	assert.Equal(t, stream.Blocks[1].Header.Filters(), double.Flags())
+	assert.Equal(t, stream.Blocks[2].Header.Filters(), double.Flags())
+
+	r, err := NewReader(&compressed)
+	assert.Nil(t, err)
+	decoded, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, decoded, input, "decoding should undo encoding")
+}
+
+func TestProgress(t *testing.T) {
+	chain := FilterChain{xorFilter{testFilterID, 0x0F}}
+	input := bytes.Repeat([]byte("progress "), 300)
+
+	var compressed bytes.Buffer
+	var written []Progress
+	config := WriterConfig{Filters: chain, BlockSize: 1000, Progress: func(p Progress) {
+		written = append(written, p)
+	}}
+	w, err := NewWriter(&compressed, config)
+	assert.Nil(t, err)
+	_, err = w.Write(input[:500])
+	assert.Nil(t, err)
+	_, err = w.Write(input[500:])
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, len(written), 3, "progress should be reported for each Write and Close")
+	assert.Equal(t, written[0].Uncompressed, int64(500))
+	assert.Equal(t, written[2], Progress{int64(compressed.Len()), int64(len(input))}, "Close should report the totals")
+
+	var read Progress
+	r, err := NewReaderConfig(bytes.NewReader(compressed.Bytes()), ReaderConfig{Progress: func(p Progress) {
+		read = p
+	}})
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, read, written[2], "the Reader should count the same data")
+}
+
+func TestContextCanceled(t *testing.T) {
+	chain := FilterChain{xorFilter{testFilterID, 0x0F}}
+	input := bytes.Repeat([]byte("cancel "), 3*contextCheckSize/7)
+
+	// the Writer stops at the next check once the Context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	var compressed bytes.Buffer
+	config := WriterConfig{Filters: chain, Context: ctx, Progress: func(p Progress) {
+		cancel()
+	}}
+	w, err := NewWriter(&compressed, config)
+	assert.Nil(t, err)
+	_, err = w.Write(input[:100])
+	assert.Nil(t, err)
+	n, err := w.Write(input[100:])
+	assert.Equal(t, n, 0)
+	assert.True(t, errors.Is(err, context.Canceled), "the error should wrap the Context's")
+	canceled, ok := err.(*CanceledError)
+	assert.True(t, ok, "the error should be a CanceledError")
+	assert.Equal(t, canceled.Progress.Uncompressed, int64(100), "the position should be reported")
+	assert.Equal(t, w.Close(), err, "Close should fail too")
+
+	// Blocks buffered for SelectFilters are checked as they are compressed
+	ctx, cancel = context.WithCancel(context.Background())
+	config = WriterConfig{Filters: chain, BlockSize: 100, Context: ctx, SelectFilters: func(p []byte) FilterChain {
+		cancel()
+		return chain
+	}}
+	w, err = NewWriter(&compressed, config)
+	assert.Nil(t, err)
+	_, err = w.Write(input[:100])
+	assert.True(t, errors.Is(err, context.Canceled), "the pending Block should stop")
+
+	compressed.Reset()
+	w, err = NewWriter(&compressed, WriterConfig{Filters: chain})
+	assert.Nil(t, err)
+	_, err = w.Write(input)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	r, err := NewReaderConfig(&compressed, ReaderConfig{Context: ctx})
+	assert.Nil(t, err)
+	p := make([]byte, 1000)
+	_, err = io.ReadFull(r, p)
+	assert.Nil(t, err)
+	cancel()
+	_, err = r.Read(p)
+	assert.True(t, errors.Is(err, context.Canceled), "the Reader should stop")
+	assert.Equal(t, err.(*CanceledError).Progress.Uncompressed, int64(1000))
+}